@@ -1,4 +1,8 @@
 cd hello
 go build
-mkdir ../bin
+mkdir -p ../bin
 mv hello ../bin/hello
+
+cd ../server
+go build
+mv server ../bin/server
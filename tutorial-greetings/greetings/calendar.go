@@ -0,0 +1,88 @@
+package greetings
+
+import "time"
+
+// The parts of the day, as used by TemplateData.TimeOfDay and
+// Catalog.AddTimeOfDay.
+const (
+	Morning   = "morning"
+	Afternoon = "afternoon"
+	Evening   = "evening"
+	Night     = "night"
+)
+
+// Birthday is the occasion used on a Recipient's birthday.
+const Birthday = "birthday"
+
+// Occasion is a yearly date worth a special greeting, e.g. a holiday.
+type Occasion struct {
+	// Name is the occasion name formats are registered under in
+	// the catalog, e.g. "new-year".
+	Name  string
+	Month time.Month
+	Day   int
+}
+
+// Calendar lists the occasions a Greeter knows about.
+type Calendar []Occasion
+
+// On returns the names of the occasions falling on t's date,
+// in calendar order.
+func (c Calendar) On(t time.Time) []string {
+	var names []string
+	for _, occasion := range c {
+		if sameDay(occasion.Month, occasion.Day, t) {
+			names = append(names, occasion.Name)
+		}
+	}
+
+	return names
+}
+
+// occasions returns the occasions the recipient celebrates at t,
+// starting with their birthday.
+func (c Calendar) occasions(r Recipient, t time.Time) []string {
+	var names []string
+	if !r.Birthday.IsZero() && sameDay(r.Birthday.Month(), r.Birthday.Day(), t) {
+		names = append(names, Birthday)
+	}
+
+	return append(names, c.On(t)...)
+}
+
+// sameDay reports whether t falls on the given month and day. On
+// non-leap years, February 29 is celebrated on February 28.
+func sameDay(month time.Month, day int, t time.Time) bool {
+	if month == time.February && day == 29 && !isLeap(t.Year()) {
+		day = 28
+	}
+
+	return t.Month() == month && t.Day() == day
+}
+
+func isLeap(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// timeOfDay names the part of the day the given hour falls in.
+func timeOfDay(hour int) string {
+	switch {
+	case hour >= 5 && hour < 12:
+		return Morning
+	case hour >= 12 && hour < 17:
+		return Afternoon
+	case hour >= 17 && hour < 21:
+		return Evening
+	default:
+		return Night
+	}
+}
+
+func isTimeOfDay(period string) bool {
+	switch period {
+	case Morning, Afternoon, Evening, Night:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package greetings
+
+import (
+	"testing"
+	"time"
+)
+
+// clockAt returns a clock stuck at the given time.
+func clockAt(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+// TestGreeterTimeOfDay checks that the greeting for the time of day
+// is picked, in the Greeter's time zone.
+func TestGreeterTimeOfDay(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	// 01:00 UTC is 08:00 in Jakarta.
+	now := clockAt(time.Date(2022, 3, 14, 1, 0, 0, 0, time.UTC))
+
+	// The general formats come first, then the time of day ones.
+	g := NewGreeter(WithClock(now), WithLocation(jakarta), WithSelector(FixedSelector(3)))
+
+	msg, err := g.Hello("Lyse")
+	if want := "Good morning, Lyse!"; msg != want || err != nil {
+		t.Fatalf(`Hello("Lyse") = %q, %v, want %q, nil`, msg, err, want)
+	}
+
+	// The recipient's own time zone takes precedence.
+	msg, err = g.Greet(Recipient{Name: "Lyse", Location: time.FixedZone("PST", -8*60*60)})
+	if want := "Good evening, Lyse!"; msg != want || err != nil {
+		t.Fatalf(`Greet = %q, %v, want %q, nil`, msg, err, want)
+	}
+}
+
+func TestGreeterOccasions(t *testing.T) {
+	calendar := Calendar{
+		{Name: "new-year", Month: time.January, Day: 1},
+		{Name: "starlight", Month: time.December, Day: 24},
+	}
+	newYear := clockAt(time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC))
+	g := NewGreeter(WithClock(newYear), WithLocation(time.UTC), WithCalendar(calendar), WithSelector(FixedSelector(0)))
+
+	msg, err := g.Hello("Urianger")
+	if want := "Happy New Year, Urianger!"; msg != want || err != nil {
+		t.Fatalf(`Hello("Urianger") = %q, %v, want %q, nil`, msg, err, want)
+	}
+
+	// Birthdays take precedence over the calendar.
+	birthday := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	msg, err = g.Greet(Recipient{Name: "Urianger", Birthday: birthday, Locale: "pt-BR"})
+	if want := "Feliz aniversário, Urianger!"; msg != want || err != nil {
+		t.Fatalf(`Greet = %q, %v, want %q, nil`, msg, err, want)
+	}
+
+	// There are no "starlight" formats, so it's an ordinary day.
+	g = NewGreeter(WithClock(clockAt(time.Date(2022, 12, 24, 23, 0, 0, 0, time.UTC))), WithLocation(time.UTC), WithCalendar(calendar), WithSelector(FixedSelector(0)))
+	msg, err = g.Hello("Urianger")
+	if want := "Hi, Urianger. Welcome!"; msg != want || err != nil {
+		t.Fatalf(`Hello("Urianger") = %q, %v, want %q, nil`, msg, err, want)
+	}
+}
+
+func TestOccasionTemplate(t *testing.T) {
+	g := NewGreeter(WithCatalog(NewCatalog()), WithClock(clockAt(time.Date(2023, 2, 28, 12, 0, 0, 0, time.UTC))), WithLocation(time.UTC))
+	if err := g.RegisterTemplate("en", "{{.Name}}{{if .Occasion}} ({{.Occasion}}){{end}}"); err != nil {
+		t.Fatalf(`RegisterTemplate returned %v`, err)
+	}
+
+	// There are no birthday formats, but the template still knows.
+	leapling := time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC)
+	msg, err := g.Greet(Recipient{Name: "Y'shtola", Birthday: leapling})
+	if want := "Y'shtola (birthday)"; msg != want || err != nil {
+		t.Fatalf(`Greet = %q, %v, want %q, nil`, msg, err, want)
+	}
+}
+
+func TestCalendarOn(t *testing.T) {
+	calendar := Calendar{{Name: "leap", Month: time.February, Day: 29}}
+
+	if got := calendar.On(time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)); len(got) != 1 {
+		t.Fatalf(`On(2023-02-28) = %q, want ["leap"]`, got)
+	}
+
+	if got := calendar.On(time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)); len(got) != 0 {
+		t.Fatalf(`On(2024-02-28) = %q, want none`, got)
+	}
+}
@@ -0,0 +1,235 @@
+package greetings
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is the locale that every lookup eventually
+// falls back to.
+const DefaultLocale = "en"
+
+// ErrUnknownLocale is returned when neither a locale nor any of
+// its fallbacks has greeting formats in a catalog.
+var ErrUnknownLocale = errors.New("unknown locale")
+
+// The built-in catalogs. Adding a language is a matter of dropping
+// another `<locale>.json` file in the `locales` directory.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// defaultCatalog is the catalog used by the package-level functions.
+var defaultCatalog = mustLoadDefaultCatalog()
+
+// Catalog associates locales with the greeting formats available
+// in them. Besides the general formats, a locale can have formats
+// for a time of day or for an occasion. It is safe for concurrent use.
+type Catalog struct {
+	mu      sync.RWMutex
+	formats map[catalogKey][]string
+}
+
+// catalogKey identifies a set of formats in a catalog. The locale
+// is lowercased, so that lookups for "pt-BR" and "pt-br" end up in
+// the same place. At most one of timeOfDay and occasion is set.
+type catalogKey struct {
+	locale    string
+	timeOfDay string
+	occasion  string
+}
+
+// catalogFile is the layout of a single locale file.
+type catalogFile struct {
+	Formats []string `json:"formats"`
+	// Keyed by "morning", "afternoon", "evening" or "night".
+	TimeOfDay map[string][]string `json:"timeOfDay"`
+	// Keyed by occasion name, e.g. "birthday".
+	Occasions map[string][]string `json:"occasions"`
+}
+
+// NewCatalog returns an empty catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{formats: make(map[catalogKey][]string)}
+}
+
+// DefaultCatalog returns the catalog built from the embedded
+// locale files.
+func DefaultCatalog() *Catalog {
+	return defaultCatalog
+}
+
+// LoadCatalog builds a catalog from the `*.json` files at the root
+// of fsys. Each file name (minus the extension) is the locale, e.g.
+// `pt-BR.json`, and each file contains a `formats` list, optionally
+// followed by `timeOfDay` and `occasions` objects.
+func LoadCatalog(fsys fs.FS) (*Catalog, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("LoadCatalog: %v", err)
+	}
+
+	catalog := NewCatalog()
+
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("LoadCatalog: %v", err)
+		}
+
+		var file catalogFile
+		if err := json.Unmarshal(content, &file); err != nil {
+			return nil, fmt.Errorf("LoadCatalog %q: %v", name, err)
+		}
+
+		if len(file.Formats) == 0 {
+			return nil, fmt.Errorf("LoadCatalog %q: no formats", name)
+		}
+
+		if err := file.check(); err != nil {
+			return nil, fmt.Errorf("LoadCatalog %q: %v", name, err)
+		}
+
+		locale := strings.TrimSuffix(path.Base(name), ".json")
+		catalog.Add(locale, file.Formats...)
+
+		for period, formats := range file.TimeOfDay {
+			if !isTimeOfDay(period) {
+				return nil, fmt.Errorf("LoadCatalog %q: unknown time of day %q", name, period)
+			}
+
+			catalog.AddTimeOfDay(locale, period, formats...)
+		}
+
+		for occasion, formats := range file.Occasions {
+			catalog.AddOccasion(locale, occasion, formats...)
+		}
+	}
+
+	return catalog, nil
+}
+
+// check makes sure that every format of the file has a single verb
+// for the name, as Add requires, so that a broken file fails to load
+// rather than greet with "%!(EXTRA string=...)".
+func (f catalogFile) check() error {
+	all := [][]string{f.Formats}
+	for _, formats := range f.TimeOfDay {
+		all = append(all, formats)
+	}
+
+	for _, formats := range f.Occasions {
+		all = append(all, formats)
+	}
+
+	for _, formats := range all {
+		for _, format := range formats {
+			if strings.Contains(fmt.Sprintf(format, "name"), "%!") {
+				return fmt.Errorf("format %q doesn't have a single verb for the name", format)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Add appends formats to the given locale. Each format must contain
+// a single verb for the name, e.g. "Hi, %v!".
+func (c *Catalog) Add(locale string, formats ...string) {
+	c.add(catalogKey{locale: localeKey(locale)}, formats)
+}
+
+// AddTimeOfDay appends formats used, on top of the general ones,
+// during a part of the day: "morning", "afternoon", "evening" or
+// "night".
+func (c *Catalog) AddTimeOfDay(locale, period string, formats ...string) {
+	c.add(catalogKey{locale: localeKey(locale), timeOfDay: period}, formats)
+}
+
+// AddOccasion appends formats used instead of the general ones on
+// the given occasion, e.g. "birthday" or "new-year".
+func (c *Catalog) AddOccasion(locale, occasion string, formats ...string) {
+	c.add(catalogKey{locale: localeKey(locale), occasion: occasion}, formats)
+}
+
+func (c *Catalog) add(key catalogKey, formats []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.formats[key] = append(c.formats[key], formats...)
+}
+
+// Lookup returns the formats for the locale, walking its fallback
+// chain (e.g. "pt-BR" -> "pt" -> DefaultLocale) until one of them
+// has formats. The locale that was actually used is returned, too.
+func (c *Catalog) Lookup(locale string) ([]string, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, candidate := range FallbackChain(locale) {
+		if formats := c.formats[catalogKey{locale: localeKey(candidate)}]; len(formats) > 0 {
+			return formats, candidate, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("%w: %q", ErrUnknownLocale, locale)
+}
+
+// exact returns the formats stored under the key, without walking
+// the fallback chain.
+func (c *Catalog) exact(key catalogKey) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.formats[key]
+}
+
+// FallbackChain returns the locales tried, in order, when looking up
+// the given locale. Subtags are dropped one by one from the right and
+// DefaultLocale is always the last resort.
+func FallbackChain(locale string) []string {
+	// Accept "pt_BR" as well, since that's what POSIX environments use.
+	locale = strings.Trim(strings.ReplaceAll(locale, "_", "-"), "-")
+
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+
+		idx := strings.LastIndex(locale, "-")
+		if idx == -1 {
+			break
+		}
+
+		locale = locale[:idx]
+	}
+
+	if len(chain) == 0 || localeKey(chain[len(chain)-1]) != localeKey(DefaultLocale) {
+		chain = append(chain, DefaultLocale)
+	}
+
+	return chain
+}
+
+func localeKey(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+func mustLoadDefaultCatalog() *Catalog {
+	sub, err := fs.Sub(localeFiles, "locales")
+	if err != nil {
+		panic(err)
+	}
+
+	catalog, err := LoadCatalog(sub)
+	if err != nil {
+		panic(err)
+	}
+
+	return catalog
+}
@@ -0,0 +1,71 @@
+package greetings
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned when a name can't be greeted. They are usually
+// wrapped, so check for them with errors.Is.
+var (
+	ErrEmptyName         = errors.New("invalid parameter: name is empty")
+	ErrNameTooLong       = errors.New("invalid parameter: name is too long")
+	ErrInvalidCharacters = errors.New("invalid parameter: name contains invalid characters")
+	ErrDuplicateName     = errors.New("invalid parameter: name is a duplicate")
+)
+
+// NameError records why a single name in a batch couldn't be greeted.
+type NameError struct {
+	// Index is the position of the name in the input.
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("name #%d %q: %v", e.Index, e.Name, e.Err)
+}
+
+func (e *NameError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError lists every name in a batch that couldn't be greeted.
+// errors.Is and errors.As match against any of the listed errors,
+// so errors.Is(err, ErrEmptyName) reports whether at least one of
+// the names was empty.
+type BatchError struct {
+	Errors []*NameError
+}
+
+func (e *BatchError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for idx, err := range e.Errors {
+		messages[idx] = err.Error()
+	}
+
+	return fmt.Sprintf("%d name(s) failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Is reports whether any of the listed errors matches target.
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first listed error that matches target.
+func (e *BatchError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
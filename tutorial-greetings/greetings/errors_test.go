@@ -0,0 +1,54 @@
+package greetings
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestHellosPartial calls greetings.HellosPartial with a mix of valid
+// and invalid names, checking that the valid ones are still greeted.
+func TestHellosPartial(t *testing.T) {
+	names := []string{"", "Uberdanger", strings.Repeat("a", MaxNameLength+1), "Venat", "Ven\x00at"}
+	msgs, err := HellosPartial(names)
+
+	if len(msgs) != 2 || msgs["Uberdanger"] == "" || msgs["Venat"] == "" {
+		t.Fatalf(`HellosPartial(%q) = %q, want greetings for "Uberdanger" and "Venat"`, names, msgs)
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf(`HellosPartial(%q) returned %v, want *BatchError`, names, err)
+	}
+
+	want := map[int]error{0: ErrEmptyName, 2: ErrNameTooLong, 4: ErrInvalidCharacters}
+	if len(batchErr.Errors) != len(want) {
+		t.Fatalf(`Expected %d failed names, got %d: %v`, len(want), len(batchErr.Errors), err)
+	}
+
+	for _, nameErr := range batchErr.Errors {
+		if !errors.Is(nameErr, want[nameErr.Index]) {
+			t.Errorf(`Name #%d failed with %v, want %v`, nameErr.Index, nameErr.Err, want[nameErr.Index])
+		}
+	}
+
+	for _, sentinel := range want {
+		if !errors.Is(err, sentinel) {
+			t.Errorf(`errors.Is(%v, %v) = false, want true`, err, sentinel)
+		}
+	}
+}
+
+func TestHellosPartialValid(t *testing.T) {
+	msgs, err := HellosPartial([]string{"Thancred", "Uberdanger", "Venat"})
+
+	if len(msgs) != 3 || err != nil {
+		t.Fatalf(`HellosPartial returned %d greetings, %v, want 3, nil`, len(msgs), err)
+	}
+}
+
+func TestHelloEmptyIsErrEmptyName(t *testing.T) {
+	if _, err := Hello(""); !errors.Is(err, ErrEmptyName) {
+		t.Fatalf(`Hello("") returned %v, want ErrEmptyName`, err)
+	}
+}
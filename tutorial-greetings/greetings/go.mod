@@ -1,3 +1,5 @@
 module example.com/greetings
 
 go 1.17
+
+require golang.org/x/text v0.3.7
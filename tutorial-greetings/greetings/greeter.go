@@ -0,0 +1,366 @@
+package greetings
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Greeter builds greeting messages. Unlike the package-level
+// functions, the catalog and the way formats are selected can be
+// configured, which makes the output reproducible when needed.
+type Greeter struct {
+	catalog   *Catalog
+	selector  Selector
+	validator Validator
+	now       func() time.Time
+	location  *time.Location
+	calendar  Calendar
+
+	mu sync.RWMutex
+	// Templates registered at runtime, keyed like the catalog.
+	templates map[string][]format
+}
+
+// Recipient describes the person being greeted.
+type Recipient struct {
+	Name string
+	// Title is an optional honorific such as "Dr." that
+	// templates can use.
+	Title string
+	// Locale is the locale to greet in. It defaults to
+	// DefaultLocale when empty.
+	Locale string
+	// Birthday, when set, gets the recipient a birthday greeting
+	// on the day. Only the month and day are used.
+	Birthday time.Time
+	// Location is the recipient's time zone. It defaults to the
+	// Greeter's.
+	Location *time.Location
+}
+
+// Greeting is a greeting message along with how it was made.
+type Greeting struct {
+	// Name is the name as greeted, i.e. after normalization.
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	// Format is the format or template the message was made from.
+	Format string `json:"format"`
+	// Locale is the locale the greeting was resolved to.
+	Locale string `json:"locale"`
+}
+
+// Option configures a Greeter.
+type Option func(*Greeter)
+
+// WithCatalog makes the Greeter use formats from the given catalog
+// instead of the built-in one.
+func WithCatalog(catalog *Catalog) Option {
+	return func(g *Greeter) {
+		g.catalog = catalog
+	}
+}
+
+// WithSelector sets the strategy used to pick a format.
+func WithSelector(selector Selector) Option {
+	return func(g *Greeter) {
+		g.selector = selector
+	}
+}
+
+// WithValidator sets how names are checked and normalized
+// before being greeted.
+func WithValidator(validator Validator) Option {
+	return func(g *Greeter) {
+		g.validator = validator
+	}
+}
+
+// WithClock sets the function the Greeter gets the current time
+// from. It defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(g *Greeter) {
+		g.now = now
+	}
+}
+
+// WithLocation sets the time zone used to tell the time of day and
+// the date of occasions. It defaults to time.Local.
+func WithLocation(location *time.Location) Option {
+	return func(g *Greeter) {
+		g.location = location
+	}
+}
+
+// WithCalendar sets the occasions, e.g. holidays, that get
+// a special greeting.
+func WithCalendar(calendar Calendar) Option {
+	return func(g *Greeter) {
+		g.calendar = calendar
+	}
+}
+
+// WithSeed makes the Greeter pick formats at random, using a source
+// seeded with the given value. Two greeters with the same seed
+// produce the same sequence of greetings only at the same time of
+// day, and on the same occasions, since the formats picked from
+// depend on them: use WithClock as well for greetings that don't
+// depend on when they're made.
+func WithSeed(seed int64) Option {
+	return WithSelector(NewRandomSelector(rand.NewSource(seed)))
+}
+
+// NewGreeter returns a Greeter that, unless configured otherwise,
+// picks formats at random from the built-in catalog.
+func NewGreeter(opts ...Option) *Greeter {
+	g := &Greeter{
+		catalog:   defaultCatalog,
+		selector:  NewRandomSelector(rand.NewSource(time.Now().UnixNano())),
+		validator: DefaultValidator(),
+		now:       time.Now,
+		location:  time.Local,
+		templates: make(map[string][]format),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+// RegisterTemplate adds a greeting format to the given locale,
+// written as a text/template with access to the fields in
+// TemplateData, e.g. "Good {{.TimeOfDay}}, {{.Title}} {{.Name}}!".
+// Templates referring to unknown fields return an ErrUnknownField.
+// Registered templates are picked alongside the catalog's formats.
+func (g *Greeter) RegisterTemplate(locale, text string) error {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return fmt.Errorf("RegisterTemplate %q: %w", text, err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := localeKey(locale)
+	g.templates[key] = append(g.templates[key], format{text: text, tmpl: tmpl})
+	return nil
+}
+
+// Greet returns a greeting for the recipient.
+func (g *Greeter) Greet(r Recipient) (string, error) {
+	greeting, err := g.greet(r)
+	return greeting.Message, err
+}
+
+// Hello returns a greeting for the named person.
+func (g *Greeter) Hello(name string) (string, error) {
+	return g.HelloIn(DefaultLocale, name)
+}
+
+// HelloIn returns a greeting for the named person in the given locale.
+func (g *Greeter) HelloIn(locale, name string) (string, error) {
+	return g.Greet(Recipient{Name: name, Locale: locale})
+}
+
+// Hellos returns a map that associates each of the named people
+// with a greeting message.
+func (g *Greeter) Hellos(names []string) (map[string]string, error) {
+	// A map to associate names with messages.
+	messages := make(map[string]string)
+	dedup := g.dedup()
+
+	// Loop through the received silice of names, calling
+	// the Hello function to get a message for each name.
+	for idx, name := range names {
+		greeting, err := g.greet(Recipient{Name: name})
+		if err == nil {
+			err = dedup(idx, greeting.Name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// In the map, associate the retrieved message
+		// with the name.
+		messages[name] = greeting.Message
+	}
+
+	return messages, nil
+}
+
+// HellosPartial is like Hellos, but it doesn't stop at the first
+// name that can't be greeted. It returns the greetings for every
+// valid name and, if any name failed, a *BatchError listing them.
+func (g *Greeter) HellosPartial(names []string) (map[string]string, error) {
+	messages := make(map[string]string)
+	dedup := g.dedup()
+	var failed []*NameError
+
+	for idx, name := range names {
+		greeting, err := g.greet(Recipient{Name: name})
+		if err == nil {
+			err = dedup(idx, greeting.Name)
+		}
+
+		if err != nil {
+			failed = append(failed, &NameError{Index: idx, Name: name, Err: err})
+			continue
+		}
+
+		messages[name] = greeting.Message
+	}
+
+	if len(failed) > 0 {
+		return messages, &BatchError{Errors: failed}
+	}
+
+	return messages, nil
+}
+
+// HellosOrdered is like Hellos, but it returns the greetings in
+// input order, one for each name, duplicates included.
+func (g *Greeter) HellosOrdered(names []string) ([]Greeting, error) {
+	list := make([]Greeting, 0, len(names))
+	dedup := g.dedup()
+
+	for idx, name := range names {
+		greeting, err := g.greet(Recipient{Name: name})
+		if err == nil {
+			err = dedup(idx, greeting.Name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, greeting)
+	}
+
+	return list, nil
+}
+
+// greet returns a greeting for the recipient.
+func (g *Greeter) greet(r Recipient) (Greeting, error) {
+	// If the name is empty or otherwise unusable, return
+	// an error with a message.
+	name, err := g.validator.Validate(r.Name)
+	if err != nil {
+		return Greeting{}, err
+	}
+
+	if r.Locale == "" {
+		r.Locale = DefaultLocale
+	}
+
+	if r.Location == nil {
+		r.Location = g.location
+	}
+
+	now := g.now().In(r.Location)
+	period := timeOfDay(now.Hour())
+
+	occasions := g.calendar.occasions(r, now)
+
+	formats, locale, occasion, err := g.lookup(r.Locale, period, occasions)
+	if err != nil {
+		return Greeting{}, err
+	}
+
+	// Templates can still make something of the occasion, even if
+	// the catalog has nothing for it.
+	if occasion == "" && len(occasions) > 0 {
+		occasion = occasions[0]
+	}
+
+	// Return a greeting that embeds the name in a message.
+	f := g.format(formats)
+	message, err := f.render(TemplateData{
+		Name:      name,
+		Title:     r.Title,
+		TimeOfDay: period,
+		Locale:    locale,
+		Occasion:  occasion,
+	})
+	if err != nil {
+		return Greeting{}, err
+	}
+
+	return Greeting{Name: name, Message: message, Format: f.text, Locale: locale}, nil
+}
+
+// lookup is like Catalog.Lookup, but it also takes the registered
+// templates, the time of day and the occasions into account. At
+// each step of the fallback chain, the formats for the first
+// occasion that has any are used. Otherwise, the general formats
+// and the ones for the time of day are used together. The most
+// specific locale with any formats wins, so that a locale without
+// a birthday greeting doesn't get one in another language.
+func (g *Greeter) lookup(locale, period string, occasions []string) ([]format, string, string, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, candidate := range FallbackChain(locale) {
+		key := localeKey(candidate)
+
+		for _, occasion := range occasions {
+			if texts := g.catalog.exact(catalogKey{locale: key, occasion: occasion}); len(texts) > 0 {
+				return plainFormats(texts), candidate, occasion, nil
+			}
+		}
+
+		formats := plainFormats(g.catalog.exact(catalogKey{locale: key}))
+		formats = append(formats, plainFormats(g.catalog.exact(catalogKey{locale: key, timeOfDay: period}))...)
+		formats = append(formats, g.templates[key]...)
+
+		if len(formats) > 0 {
+			return formats, candidate, "", nil
+		}
+	}
+
+	return nil, "", "", fmt.Errorf("%w: %q", ErrUnknownLocale, locale)
+}
+
+func plainFormats(texts []string) []format {
+	formats := make([]format, len(texts))
+	for idx, text := range texts {
+		formats[idx] = format{text: text}
+	}
+
+	return formats
+}
+
+// dedup returns a function that reports an ErrDuplicateName for
+// names seen before in the same batch, if the validator asks for it.
+// It expects names as normalized by the validator.
+func (g *Greeter) dedup() func(idx int, name string) error {
+	if !g.validator.RejectDuplicates {
+		return func(int, string) error { return nil }
+	}
+
+	seen := make(map[string]int)
+
+	return func(idx int, name string) error {
+		if first, ok := seen[name]; ok {
+			return fmt.Errorf("%w: same as name #%d", ErrDuplicateName, first)
+		}
+
+		seen[name] = idx
+		return nil
+	}
+}
+
+// format returns one of the given formats, as chosen by the selector.
+func (g *Greeter) format(formats []format) format {
+	idx := g.selector.Select(len(formats))
+
+	// Guard against selectors returning something out of range.
+	if idx < 0 || idx >= len(formats) {
+		idx = 0
+	}
+
+	return formats[idx]
+}
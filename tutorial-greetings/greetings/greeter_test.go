@@ -0,0 +1,109 @@
+package greetings
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestGreeterFixed checks that a Greeter with a fixed selector
+// always returns the same greeting.
+func TestGreeterFixed(t *testing.T) {
+	g := NewGreeter(WithSelector(FixedSelector(1)))
+
+	for i := 0; i < 3; i++ {
+		msg, err := g.Hello("Gladys")
+		if msg != "Great to see you, Gladys!" || err != nil {
+			t.Fatalf(`Hello("Gladys") = %q, %v, want "Great to see you, Gladys!", nil`, msg, err)
+		}
+	}
+}
+
+func TestGreeterRoundRobin(t *testing.T) {
+	g := NewGreeter(
+		WithSelector(NewRoundRobinSelector()),
+		WithClock(func() time.Time { return time.Date(2022, 1, 2, 23, 0, 0, 0, time.UTC) }),
+		WithLocation(time.UTC),
+	)
+	want := []string{
+		"Hi, Venat. Welcome!",
+		"Great to see you, Venat!",
+		"Hail, Venat! Well met!",
+		"Hi, Venat. Welcome!",
+	}
+
+	for _, w := range want {
+		msg, err := g.Hello("Venat")
+		if msg != w || err != nil {
+			t.Fatalf(`Hello("Venat") = %q, %v, want %q, nil`, msg, err, w)
+		}
+	}
+}
+
+// TestGreeterSeed checks that two greeters seeded with the same
+// value produce the same greetings at the same time.
+func TestGreeterSeed(t *testing.T) {
+	now := clockAt(time.Date(2022, 1, 2, 9, 0, 0, 0, time.UTC))
+	a := NewGreeter(WithSeed(42), WithClock(now))
+	b := NewGreeter(WithSeed(42), WithClock(now))
+
+	for i := 0; i < 10; i++ {
+		msgA, _ := a.Hello("Thancred")
+		msgB, _ := b.Hello("Thancred")
+
+		if msgA != msgB {
+			t.Fatalf(`Seeded greeters diverged at %d: %q != %q`, i, msgA, msgB)
+		}
+	}
+}
+
+func TestWeightedSelector(t *testing.T) {
+	s := NewWeightedSelector(rand.NewSource(1), 0, 5, 0)
+
+	for i := 0; i < 100; i++ {
+		if idx := s.Select(3); idx != 1 {
+			t.Fatalf(`Select(3) = %d, want 1`, idx)
+		}
+	}
+
+	// Formats without a weight count as weight 1.
+	if idx := NewWeightedSelector(rand.NewSource(1), 0).Select(2); idx != 1 {
+		t.Fatalf(`Select(2) = %d, want 1`, idx)
+	}
+}
+
+func TestFixedSelectorWraps(t *testing.T) {
+	if idx := FixedSelector(4).Select(3); idx != 1 {
+		t.Fatalf(`FixedSelector(4).Select(3) = %d, want 1`, idx)
+	}
+
+	if idx := FixedSelector(-1).Select(3); idx != 2 {
+		t.Fatalf(`FixedSelector(-1).Select(3) = %d, want 2`, idx)
+	}
+}
+
+// TestHellosOrdered checks that greetings come back in input order,
+// keeping duplicates and recording how they were made.
+func TestHellosOrdered(t *testing.T) {
+	g := NewGreeter(WithSelector(FixedSelector(2)))
+	names := []string{"Venat", " Hades ", "Venat"}
+
+	list, err := g.HellosOrdered(names)
+	if len(list) != 3 || err != nil {
+		t.Fatalf(`HellosOrdered(%q) returned %d greetings, %v, want 3, nil`, names, len(list), err)
+	}
+
+	want := Greeting{Name: "Hades", Message: "Hail, Hades! Well met!", Format: "Hail, %v! Well met!", Locale: "en"}
+	if list[1] != want {
+		t.Fatalf(`HellosOrdered(%q)[1] = %+v, want %+v`, names, list[1], want)
+	}
+
+	if list[0].Name != "Venat" || list[2].Name != "Venat" {
+		t.Fatalf(`HellosOrdered(%q) = %+v, want "Venat" first and last`, names, list)
+	}
+
+	if list, err := g.HellosOrdered([]string{"Venat", ""}); list != nil || !errors.Is(err, ErrEmptyName) {
+		t.Fatalf(`HellosOrdered with an empty name = %+v, %v, want nil, ErrEmptyName`, list, err)
+	}
+}
@@ -1,63 +1,35 @@
 package greetings
 
-import (
-	"errors"
-	"fmt"
-	"math/rand"
-	"time"
-)
+// defaultGreeter backs the package-level functions. It picks
+// formats at random from the built-in catalog.
+var defaultGreeter = NewGreeter()
 
 // Hello returns a greeting for the named person.
 func Hello(name string) (string, error) {
-	// If no name was given, return an error with a message.
-	if name == "" {
-		return "", errors.New("invalid parameter: name is empty")
-	}
+	return defaultGreeter.Hello(name)
+}
 
-	// Return a greeting that embeds the name in a message.
-	message := fmt.Sprintf(randomFormat(), name)
-	return message, nil
+// HelloIn returns a greeting for the named person in the given
+// locale, e.g. "pt-BR". Locales missing from the catalog fall back
+// to their parent locale and, eventually, to DefaultLocale.
+func HelloIn(locale, name string) (string, error) {
+	return defaultGreeter.HelloIn(locale, name)
 }
 
 // Hellos returns a map that associates each of the named people
 // with a greeting message.
 func Hellos(names []string) (map[string]string, error) {
-	// A map to associate names with messages.
-	messages := make(map[string]string)
-
-	// Loop through the received silice of names, calling
-	// the Hello function to get a message for each name.
-	for _, name := range names {
-		message, err := Hello(name)
-
-		if err != nil {
-			return nil, err
-		}
-
-		// In the map, associate the retrieved message
-		// with the name.
-		messages[name] = message
-	}
-
-	return messages, nil
+	return defaultGreeter.Hellos(names)
 }
 
-// init sets initial values for variables used in the function.
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// HellosPartial returns the greetings for every valid name and,
+// if any name couldn't be greeted, a *BatchError listing them.
+func HellosPartial(names []string) (map[string]string, error) {
+	return defaultGreeter.HellosPartial(names)
 }
 
-// randomFormat returns one of a set of greeting messages. The returned
-// messsage is selected at random.
-func randomFormat() string {
-	// A slice of message formats.
-	formats := []string{
-		"Hi, %v. Welcome!",
-		"Great to see you, %v!",
-		"Hail, %v! Well met!",
-	}
-
-	// Return a randomly selected message format by specifying
-	// a random index for the slice of formats.
-	return formats[rand.Intn(len(formats))]
+// HellosOrdered returns a greeting for each of the named people,
+// in the same order as the names, duplicates included.
+func HellosOrdered(names []string) ([]Greeting, error) {
+	return defaultGreeter.HellosOrdered(names)
 }
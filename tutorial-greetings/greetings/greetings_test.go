@@ -1,8 +1,12 @@
 package greetings
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"regexp"
 	"testing"
+	"testing/fstest"
 )
 
 // TestHelloName calls greetings.Hello with a name,
@@ -49,3 +53,81 @@ func TestHellosEmpty(t *testing.T) {
 		t.Fatalf(`Expected error from Hellos([]string{"", "Uberdanger", "Venat"}), got nil instead`)
 	}
 }
+
+// TestHelloInFallback calls greetings.HelloIn with a locale that
+// isn't in the catalog, checking that its parent locale is used.
+func TestHelloInFallback(t *testing.T) {
+	formats, locale, err := DefaultCatalog().Lookup("pt-PT")
+	if locale != "pt" || err != nil {
+		t.Fatalf(`Lookup("pt-PT") = %q, %v, want "pt", nil`, locale, err)
+	}
+
+	// Depending on the time of day, the greeting may also come
+	// from one of these.
+	for _, period := range []string{Morning, Afternoon, Evening, Night} {
+		formats = append(formats, defaultCatalog.exact(catalogKey{locale: "pt", timeOfDay: period})...)
+	}
+
+	msg, err := HelloIn("pt-PT", "Gladys")
+	if err != nil {
+		t.Fatalf(`HelloIn("pt-PT", "Gladys") returned %v`, err)
+	}
+
+	for _, format := range formats {
+		if msg == fmt.Sprintf(format, "Gladys") {
+			return
+		}
+	}
+
+	t.Fatalf(`HelloIn("pt-PT", "Gladys") = %q, want one of %q`, msg, formats)
+}
+
+func TestFallbackChain(t *testing.T) {
+	tests := map[string][]string{
+		"pt-BR":      {"pt-BR", "pt", "en"},
+		"pt_BR":      {"pt-BR", "pt", "en"},
+		"en-US":      {"en-US", "en"},
+		"zh-Hant-TW": {"zh-Hant-TW", "zh-Hant", "zh", "en"},
+		"":           {"en"},
+	}
+
+	for locale, want := range tests {
+		got := FallbackChain(locale)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf(`FallbackChain(%q) = %q, want %q`, locale, got, want)
+		}
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	fsys := fstest.MapFS{
+		"de.json": {Data: []byte(`{"formats": ["Hallo, %v!"]}`)},
+	}
+
+	catalog, err := LoadCatalog(fsys)
+	if err != nil {
+		t.Fatalf(`LoadCatalog returned %v`, err)
+	}
+
+	formats, locale, err := catalog.Lookup("de-AT")
+	if locale != "de" || len(formats) != 1 || err != nil {
+		t.Fatalf(`Lookup("de-AT") = %q, %q, %v, want ["Hallo, %%v!"], "de", nil`, formats, locale, err)
+	}
+
+	// There's no "en" in this catalog, so anything else is unknown.
+	if _, _, err := catalog.Lookup("fr"); !errors.Is(err, ErrUnknownLocale) {
+		t.Fatalf(`Lookup("fr") returned %v, want ErrUnknownLocale`, err)
+	}
+
+	// Formats must have a single verb for the name.
+	for _, data := range []string{
+		`{"formats": ["Hallo!"]}`,
+		`{"formats": ["Hallo, %v und %v!"]}`,
+		`{"formats": ["Hallo, %v!"], "timeOfDay": {"morning": ["Guten Morgen!"]}}`,
+		`{"formats": ["Hallo, %v!"], "occasions": {"birthday": ["%v, %v!"]}}`,
+	} {
+		if _, err := LoadCatalog(fstest.MapFS{"de.json": {Data: []byte(data)}}); err == nil {
+			t.Errorf(`LoadCatalog of %s succeeded, want an error`, data)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package greetings
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// Selector picks which of n greeting formats to use. Select is
+// only called with n > 0 and must return an index in [0, n).
+// Selectors may be called from multiple goroutines.
+type Selector interface {
+	Select(n int) int
+}
+
+// SelectorFunc adapts an ordinary function to the Selector interface.
+type SelectorFunc func(n int) int
+
+// Select calls f(n).
+func (f SelectorFunc) Select(n int) int {
+	return f(n)
+}
+
+// FixedSelector always picks the same format. Indices past the
+// number of formats wrap around.
+type FixedSelector int
+
+// Select returns the fixed index, modulo n.
+func (f FixedSelector) Select(n int) int {
+	idx := int(f) % n
+	if idx < 0 {
+		idx += n
+	}
+
+	return idx
+}
+
+type randomSelector struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewRandomSelector returns a Selector that picks formats uniformly
+// at random, drawing from src.
+func NewRandomSelector(src rand.Source) Selector {
+	return &randomSelector{r: rand.New(src)}
+}
+
+func (s *randomSelector) Select(n int) int {
+	// rand.Rand isn't safe for concurrent use on its own.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.r.Intn(n)
+}
+
+type roundRobinSelector struct {
+	next uint64
+}
+
+// NewRoundRobinSelector returns a Selector that cycles through the
+// formats in order, starting from the first one.
+func NewRoundRobinSelector() Selector {
+	return &roundRobinSelector{}
+}
+
+func (s *roundRobinSelector) Select(n int) int {
+	return int((atomic.AddUint64(&s.next, 1) - 1) % uint64(n))
+}
+
+type weightedSelector struct {
+	random  *randomSelector
+	weights []int
+}
+
+// NewWeightedSelector returns a Selector that picks the format at
+// index i with a probability proportional to weights[i], drawing
+// from src. Formats without a weight count as weight 1, and
+// negative weights count as 0.
+func NewWeightedSelector(src rand.Source, weights ...int) Selector {
+	return &weightedSelector{
+		random:  &randomSelector{r: rand.New(src)},
+		weights: weights,
+	}
+}
+
+func (s *weightedSelector) Select(n int) int {
+	total := 0
+	for i := 0; i < n; i++ {
+		total += s.weight(i)
+	}
+
+	// Every format has been weighted out; there's nothing
+	// sensible to pick, so use the first one.
+	if total == 0 {
+		return 0
+	}
+
+	pick := s.random.Select(total)
+	for i := 0; i < n; i++ {
+		pick -= s.weight(i)
+		if pick < 0 {
+			return i
+		}
+	}
+
+	return n - 1
+}
+
+func (s *weightedSelector) weight(i int) int {
+	if i >= len(s.weights) {
+		return 1
+	}
+
+	if s.weights[i] < 0 {
+		return 0
+	}
+
+	return s.weights[i]
+}
@@ -0,0 +1,222 @@
+package greetings
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Result is the outcome of greeting a single name in a stream.
+type Result struct {
+	// Index is the position of the name in the input.
+	Index   int
+	Name    string
+	Message string
+	Err     error
+
+	// greeting is the whole greeting, whose name is the one
+	// normalized by the validator, used to detect duplicates.
+	greeting Greeting
+}
+
+// Greeting returns the greeting along with how it was made, or the
+// zero Greeting if Err is set.
+func (r Result) Greeting() Greeting {
+	return r.greeting
+}
+
+// StreamOptions configures Greeter.Stream.
+type StreamOptions struct {
+	// Workers is the number of names greeted concurrently.
+	// It defaults to runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Ordered makes results come out in input order. Otherwise
+	// they come out as soon as they're ready.
+	Ordered bool
+
+	// Locale is the locale to greet in. It defaults to
+	// DefaultLocale when empty.
+	Locale string
+}
+
+// job is a name waiting for a worker.
+type job struct {
+	index int
+	name  string
+}
+
+// Stream greets the names received on the channel using a bounded
+// pool of workers, sending a Result for each of them on the
+// returned channel. Names that can't be greeted get a Result with
+// Err set rather than stopping the stream.
+//
+// The returned channel is closed once names is closed and every
+// result has been sent, or as soon as ctx is done. Callers must
+// either drain it or cancel ctx.
+//
+// If the validator rejects duplicates, the first occurrence in the
+// output wins, which is only the first in the input when Ordered
+// is set. Likewise, with more than one worker, which format each
+// name gets depends on scheduling, even with a seeded selector.
+func (g *Greeter) Stream(ctx context.Context, names <-chan string, opts StreamOptions) <-chan Result {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make(chan job)
+	results := make(chan Result, workers)
+
+	// In ordered mode, a slow name holds back every name after it.
+	// Limit how many results can pile up behind it.
+	var window chan struct{}
+	if opts.Ordered {
+		window = make(chan struct{}, 4*workers)
+	}
+
+	// Number the names and hand them out to the workers.
+	go func() {
+		defer close(jobs)
+
+		for index := 0; ; index++ {
+			var name string
+			var ok bool
+
+			select {
+			case <-ctx.Done():
+				return
+			case name, ok = <-names:
+				if !ok {
+					return
+				}
+			}
+
+			if window != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case window <- struct{}{}:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- job{index: index, name: name}:
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				greeting, err := g.greet(Recipient{Name: j.name, Locale: opts.Locale})
+				result := Result{Index: j.index, Name: j.name, Message: greeting.Message, Err: err, greeting: greeting}
+
+				select {
+				case <-ctx.Done():
+					return
+				case results <- result:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	out := make(chan Result)
+	go g.emit(ctx, results, out, window)
+
+	return out
+}
+
+// StreamFunc is like Stream, but it pulls the names from an
+// iterator: next is called until it returns false. next is only
+// ever called from a single goroutine.
+func (g *Greeter) StreamFunc(ctx context.Context, next func() (string, bool), opts StreamOptions) <-chan Result {
+	names := make(chan string)
+
+	go func() {
+		defer close(names)
+
+		for {
+			name, ok := next()
+			if !ok {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case names <- name:
+			}
+		}
+	}()
+
+	return g.Stream(ctx, names, opts)
+}
+
+// emit forwards results to out, putting them back in input order
+// when window is set, and flags duplicates along the way.
+func (g *Greeter) emit(ctx context.Context, results <-chan Result, out chan<- Result, window chan struct{}) {
+	defer close(out)
+
+	dedup := g.dedup()
+	send := func(result Result) bool {
+		if result.Err == nil {
+			if err := dedup(result.Index, result.greeting.Name); err != nil {
+				result.Message = ""
+				result.greeting = Greeting{}
+				result.Err = err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case out <- result:
+			return true
+		}
+	}
+
+	if window == nil {
+		for result := range results {
+			if !send(result) {
+				return
+			}
+		}
+
+		return
+	}
+
+	pending := make(map[int]Result)
+	next := 0
+
+	for result := range results {
+		pending[result.Index] = result
+
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			next++
+			<-window
+
+			if !send(result) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package greetings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// sliceSource returns an iterator over the names.
+func sliceSource(names []string) func() (string, bool) {
+	idx := 0
+	return func() (string, bool) {
+		if idx == len(names) {
+			return "", false
+		}
+
+		idx++
+		return names[idx-1], true
+	}
+}
+
+func manyNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("Name %d", i)
+	}
+
+	return names
+}
+
+// TestStreamOrdered checks that every name gets a result, in input
+// order, including the ones that can't be greeted.
+func TestStreamOrdered(t *testing.T) {
+	names := manyNames(1000)
+	names[10] = ""
+
+	g := NewGreeter(WithSelector(FixedSelector(0)))
+	results := g.StreamFunc(context.Background(), sliceSource(names), StreamOptions{Workers: 8, Ordered: true, Locale: "fr"})
+
+	count := 0
+	for result := range results {
+		if result.Index != count || result.Name != names[count] {
+			t.Fatalf(`Result #%d is for name #%d %q, want %q`, count, result.Index, result.Name, names[count])
+		}
+
+		if count == 10 {
+			if !errors.Is(result.Err, ErrEmptyName) {
+				t.Fatalf(`Result #10 has error %v, want ErrEmptyName`, result.Err)
+			}
+		} else if want := fmt.Sprintf("Salut, %s. Bienvenue !", names[count]); result.Message != want || result.Err != nil {
+			t.Fatalf(`Result #%d = %q, %v, want %q, nil`, count, result.Message, result.Err, want)
+		}
+
+		count++
+	}
+
+	if count != len(names) {
+		t.Fatalf(`Got %d results, want %d`, count, len(names))
+	}
+}
+
+func TestStreamUnordered(t *testing.T) {
+	names := manyNames(1000)
+	names = append(names, names[0])
+
+	v := DefaultValidator()
+	v.RejectDuplicates = true
+	g := NewGreeter(WithValidator(v))
+
+	seen := make(map[int]bool)
+	duplicates := 0
+
+	for result := range g.StreamFunc(context.Background(), sliceSource(names), StreamOptions{Workers: 8}) {
+		seen[result.Index] = true
+		if errors.Is(result.Err, ErrDuplicateName) {
+			duplicates++
+		}
+	}
+
+	if len(seen) != len(names) || duplicates != 1 {
+		t.Fatalf(`Got %d results with %d duplicates, want %d with 1`, len(seen), duplicates, len(names))
+	}
+}
+
+// TestStreamCancel checks that the stream stops once the context
+// is canceled, even though the names never run out.
+func TestStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	forever := func() (string, bool) { return "Hythlodaeus", true }
+
+	results := NewGreeter().StreamFunc(ctx, forever, StreamOptions{Workers: 4, Ordered: true})
+	for i := 0; i < 100; i++ {
+		<-results
+	}
+
+	cancel()
+
+	// Drain whatever was already on its way; the channel must close.
+	for range results {
+	}
+}
+
+const benchmarkNames = 10000
+
+func BenchmarkHellos(b *testing.B) {
+	names := manyNames(benchmarkNames)
+	g := NewGreeter()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Hellos(names); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStreamOrdered(b *testing.B) {
+	benchmarkStream(b, StreamOptions{Ordered: true})
+}
+
+func BenchmarkStreamUnordered(b *testing.B) {
+	benchmarkStream(b, StreamOptions{})
+}
+
+func benchmarkStream(b *testing.B, opts StreamOptions) {
+	names := manyNames(benchmarkNames)
+	g := NewGreeter()
+
+	for i := 0; i < b.N; i++ {
+		for result := range g.StreamFunc(context.Background(), sliceSource(names), opts) {
+			if result.Err != nil {
+				b.Fatal(result.Err)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package greetings
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ErrUnknownField is returned when a greeting template refers to a
+// field that TemplateData doesn't have.
+var ErrUnknownField = errors.New("unknown template field")
+
+// TemplateData holds the values greeting templates can refer to,
+// e.g. "{{.Title}} {{.Name}}, good {{.TimeOfDay}}!".
+type TemplateData struct {
+	Name  string
+	Title string
+	// TimeOfDay is one of "morning", "afternoon", "evening"
+	// or "night".
+	TimeOfDay string
+	// Locale is the locale the greeting was resolved to.
+	Locale string
+	// Occasion is the occasion the recipient celebrates today,
+	// e.g. "birthday", or empty on an ordinary day.
+	Occasion string
+}
+
+// templateFields lists the fields in TemplateData.
+var templateFields = fieldNames(reflect.TypeOf(TemplateData{}))
+
+// format is a single greeting format: either a fmt-style format
+// with a verb for the name, or a template.
+type format struct {
+	text string
+	tmpl *template.Template
+}
+
+// render returns the greeting for the given data.
+func (f format) render(data TemplateData) (string, error) {
+	if f.tmpl == nil {
+		return fmt.Sprintf(f.text, data.Name), nil
+	}
+
+	var b strings.Builder
+	if err := f.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// parseTemplate compiles a greeting template, making sure it only
+// refers to fields that exist in TemplateData.
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("greeting").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkFields(tmpl.Tree.Root); err != nil {
+		return nil, err
+	}
+
+	// Catch whatever else can only go wrong at execution time.
+	if err := tmpl.Execute(io.Discard, TemplateData{}); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// checkFields walks a template's parse tree, returning an
+// ErrUnknownField for the first field not in TemplateData.
+func checkFields(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, child := range n.Nodes {
+			if err := checkFields(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkFields(n.Pipe)
+	case *parse.TemplateNode:
+		return checkFields(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, cmd := range n.Cmds {
+			if err := checkFields(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := checkFields(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.ChainNode:
+		return checkFields(n.Node)
+	case *parse.FieldNode:
+		return checkIdent(n.Ident)
+	case *parse.VariableNode:
+		// Only $ is known to be the TemplateData; other variables
+		// can hold anything.
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			return checkIdent(n.Ident[1:])
+		}
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode, true)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode, false)
+	case *parse.RangeNode:
+		return checkBranch(&n.BranchNode, false)
+	}
+
+	return nil
+}
+
+// checkBranch checks an if, with or range node. For the latter two,
+// dot isn't the TemplateData inside the body, so it's skipped.
+func checkBranch(n *parse.BranchNode, keepsDot bool) error {
+	if err := checkFields(n.Pipe); err != nil {
+		return err
+	}
+
+	if keepsDot {
+		if err := checkFields(n.List); err != nil {
+			return err
+		}
+	}
+
+	return checkFields(n.ElseList)
+}
+
+func checkIdent(ident []string) error {
+	// Every field is a string, so there's nothing to chain onto.
+	if len(ident) == 1 {
+		for _, field := range templateFields {
+			if ident[0] == field {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w %q (known fields: %s)", ErrUnknownField, strings.Join(ident, "."), strings.Join(templateFields, ", "))
+}
+
+func fieldNames(t reflect.Type) []string {
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i] = t.Field(i).Name
+	}
+
+	return names
+}
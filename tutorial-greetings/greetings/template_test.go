@@ -0,0 +1,65 @@
+package greetings
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRegisterTemplate checks that registered templates can use
+// every field in TemplateData.
+func TestRegisterTemplate(t *testing.T) {
+	g := NewGreeter(
+		WithCatalog(NewCatalog()),
+		WithClock(func() time.Time { return time.Date(2022, 1, 2, 9, 0, 0, 0, time.UTC) }),
+		WithLocation(time.UTC),
+	)
+
+	if err := g.RegisterTemplate("pt", "[{{.Locale}}] Good {{.TimeOfDay}}, {{if .Title}}{{.Title}} {{end}}{{.Name}}!"); err != nil {
+		t.Fatalf(`RegisterTemplate returned %v`, err)
+	}
+
+	msg, err := g.Greet(Recipient{Name: "Gladys", Title: "Dr.", Locale: "pt-BR"})
+	if want := "[pt] Good morning, Dr. Gladys!"; msg != want || err != nil {
+		t.Fatalf(`Greet = %q, %v, want %q, nil`, msg, err, want)
+	}
+
+	msg, err = g.HelloIn("pt", "Gladys")
+	if want := "[pt] Good morning, Gladys!"; msg != want || err != nil {
+		t.Fatalf(`HelloIn("pt", "Gladys") = %q, %v, want %q, nil`, msg, err, want)
+	}
+
+	// Only "pt" has formats, and there's no "en" to fall back to.
+	if _, err := g.Hello("Gladys"); !errors.Is(err, ErrUnknownLocale) {
+		t.Fatalf(`Hello("Gladys") returned %v, want ErrUnknownLocale`, err)
+	}
+}
+
+func TestRegisterTemplateUnknownField(t *testing.T) {
+	g := NewGreeter()
+	templates := []string{
+		"Hi, {{.Nmae}}!",
+		"Hi, {{$.Nmae}}!",
+		"Hi, {{.Name.First}}!",
+		"{{if .Nickname}}Hi{{end}}, {{.Name}}!",
+		"{{if .Title}}Hi{{else}}{{.Surname}}{{end}}!",
+	}
+
+	for _, text := range templates {
+		if err := g.RegisterTemplate("en", text); !errors.Is(err, ErrUnknownField) {
+			t.Errorf(`RegisterTemplate(%q) returned %v, want ErrUnknownField`, text, err)
+		}
+	}
+}
+
+func TestRegisterTemplateInvalid(t *testing.T) {
+	g := NewGreeter()
+
+	if err := g.RegisterTemplate("en", "Hi, {{.Name"); err == nil {
+		t.Fatalf(`RegisterTemplate with a syntax error returned nil`)
+	}
+
+	if err := g.RegisterTemplate("en", "Hi, {{len 1}}!"); err == nil {
+		t.Fatalf(`RegisterTemplate with a bad function call returned nil`)
+	}
+}
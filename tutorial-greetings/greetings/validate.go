@@ -0,0 +1,82 @@
+package greetings
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxNameLength is the default maximum number of characters (runes)
+// allowed in a name.
+const MaxNameLength = 128
+
+// Validator checks names before they are greeted and normalizes
+// them. The zero value only rejects empty names and invalid UTF-8.
+type Validator struct {
+	// TrimSpace removes leading and trailing white space, so that
+	// names made only of white space are rejected as empty.
+	TrimSpace bool
+
+	// NFC converts names to Unicode Normalization Form C, so that
+	// e.g. "e" followed by a combining acute accent becomes "é".
+	NFC bool
+
+	// MaxLength is the maximum number of runes in a name, after
+	// normalization. Zero means no limit.
+	MaxLength int
+
+	// Disallowed lists the character classes that names can't
+	// contain, e.g. unicode.Cc for control characters.
+	Disallowed []*unicode.RangeTable
+
+	// RejectDuplicates makes Hellos and HellosPartial fail names
+	// that are the same as an earlier name once normalized.
+	RejectDuplicates bool
+}
+
+// DefaultValidator returns the Validator used unless a Greeter is
+// configured otherwise: it trims white space, normalizes to NFC,
+// caps names at MaxNameLength runes and rejects control characters.
+func DefaultValidator() Validator {
+	return Validator{
+		TrimSpace:  true,
+		NFC:        true,
+		MaxLength:  MaxNameLength,
+		Disallowed: []*unicode.RangeTable{unicode.Cc},
+	}
+}
+
+// Validate returns the normalized name, or an error wrapping one of
+// ErrEmptyName, ErrNameTooLong or ErrInvalidCharacters.
+func (v Validator) Validate(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("%w: not valid UTF-8", ErrInvalidCharacters)
+	}
+
+	if v.TrimSpace {
+		name = strings.TrimSpace(name)
+	}
+
+	if v.NFC {
+		name = norm.NFC.String(name)
+	}
+
+	if name == "" {
+		return "", ErrEmptyName
+	}
+
+	if v.MaxLength > 0 && utf8.RuneCountInString(name) > v.MaxLength {
+		return "", fmt.Errorf("%w: more than %d characters", ErrNameTooLong, v.MaxLength)
+	}
+
+	for pos, r := range name {
+		if unicode.In(r, v.Disallowed...) {
+			return "", fmt.Errorf("%w: %q at byte %d", ErrInvalidCharacters, r, pos)
+		}
+	}
+
+	return name, nil
+}
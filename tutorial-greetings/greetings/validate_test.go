@@ -0,0 +1,67 @@
+package greetings
+
+import (
+	"errors"
+	"testing"
+	"unicode"
+)
+
+func TestValidatorDefault(t *testing.T) {
+	v := DefaultValidator()
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"Gladys", "Gladys", nil},
+		{"  Gladys\t", "Gladys", nil},
+		// "e" followed by U+0301 COMBINING ACUTE ACCENT.
+		{"Rene\u0301e", "Ren\u00e9e", nil},
+		{"   ", "", ErrEmptyName},
+		{"Glad\x07ys", "", ErrInvalidCharacters},
+		{"\xff", "", ErrInvalidCharacters},
+	}
+
+	for _, test := range tests {
+		got, err := v.Validate(test.name)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf(`Validate(%q) = %q, %v, want %q, %v`, test.name, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestValidatorCustom(t *testing.T) {
+	v := Validator{MaxLength: 5, Disallowed: []*unicode.RangeTable{unicode.Digit}}
+
+	if _, err := v.Validate("Hythlodaeus"); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf(`Validate("Hythlodaeus") returned %v, want ErrNameTooLong`, err)
+	}
+
+	if _, err := v.Validate("G1"); !errors.Is(err, ErrInvalidCharacters) {
+		t.Errorf(`Validate("G1") returned %v, want ErrInvalidCharacters`, err)
+	}
+
+	// Without TrimSpace, surrounding white space is kept as is.
+	if got, err := v.Validate(" G "); got != " G " || err != nil {
+		t.Errorf(`Validate(" G ") = %q, %v, want " G ", nil`, got, err)
+	}
+}
+
+// TestHellosDuplicates checks that names which normalize to the
+// same value are rejected when the validator asks for it.
+func TestHellosDuplicates(t *testing.T) {
+	v := DefaultValidator()
+	v.RejectDuplicates = true
+	g := NewGreeter(WithValidator(v))
+
+	names := []string{"Venat", "Hades", " Venat "}
+	msgs, err := g.HellosPartial(names)
+
+	if len(msgs) != 2 || !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf(`HellosPartial(%q) = %q, %v, want 2 greetings, ErrDuplicateName`, names, msgs, err)
+	}
+
+	if msgs, err := g.Hellos(names); msgs != nil || !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf(`Hellos(%q) = %q, %v, want nil, ErrDuplicateName`, names, msgs, err)
+	}
+}
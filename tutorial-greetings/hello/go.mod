@@ -5,3 +5,5 @@ go 1.17
 replace example.com/greetings => ../greetings
 
 require example.com/greetings v0.0.0-00010101000000-000000000000
+
+require golang.org/x/text v0.3.7 // indirect
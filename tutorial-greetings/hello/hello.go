@@ -1,30 +1,181 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"time"
 
 	"example.com/greetings"
 )
 
+// Exit codes.
+const (
+	exitOK = 0
+	// Some names couldn't be greeted.
+	exitInvalidNames = 1
+	// The flags or arguments don't make sense.
+	exitUsage = 2
+	// Reading the names or writing the greetings failed.
+	exitIO = 3
+)
+
+const usage = `Usage: hello [flags] [name ...]
+
+Greets each name given as an argument. Without arguments, names are
+read from -file or from the standard input, one per line.
+
+Exit codes: 0 when every name was greeted, 1 when some names
+couldn't be greeted, 2 on usage errors and 3 on I/O errors.
+
+Flags:
+`
+
 func main() {
-	// Set properties of the predeifned Logge,r including
-	// the log entry prefix and a flag to disable printing
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is the whole command, minus the process-wide side effects,
+// so that it can be tested. It returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// Create a logger with the log entry prefix and without
 	// the time, source file, and line number.
-	log.SetPrefix("greetings: ")
-	log.SetFlags(0)
+	logger := log.New(stderr, "greetings: ", 0)
 
-	// A slice of names.
-	names := []string{"Gladys", "Samantha", "Darrin"}
+	flags := flag.NewFlagSet("hello", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
 
-	// Request a greeting message for the names.
-	message, err := greetings.Hellos(names)
+	file := flags.String("file", "", "read names from `path`, one per line (\"-\" for the standard input)")
+	format := flags.String("format", "text", "output `format`: text, json, csv or yaml")
+	locale := flags.String("locale", greetings.DefaultLocale, "`locale` to greet in, e.g. pt-BR")
+	seed := flags.Int64("seed", 0, "pick greetings reproducibly using this `seed`, along with -time")
+	at := flags.String("time", "", "greet as if it were this `time`, e.g. 2022-01-02T09:00:00+07:00, in its time zone")
+	strict := flags.Bool("strict", false, "fail without printing anything if any name can't be greeted")
 
-	// If an error was returned, print it to the console and
-	// exit the program.
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	newWriter, ok := writers[*format]
+	if !ok {
+		logger.Printf("unknown format %q", *format)
+		return exitUsage
+	}
+
+	if len(flags.Args()) > 0 && *file != "" {
+		logger.Print("names can't be given both as arguments and with -file")
+		return exitUsage
+	}
+
+	input := stdin
+	if *file != "" && *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			logger.Print(err)
+			return exitIO
+		}
+		defer f.Close()
+
+		input = f
+	}
+
+	names, err := newNameSource(flags.Args(), *file, input)
 	if err != nil {
-		log.Fatal(err)
+		logger.Print(err)
+		return exitUsage
+	}
+
+	var opts []greetings.Option
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			opts = append(opts, greetings.WithSeed(*seed))
+		}
+	})
+
+	if *at != "" {
+		// The formats depend on the time of day, so the same seed
+		// only gives the same greetings at the same time.
+		now, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			logger.Printf("invalid -time: %v", err)
+			return exitUsage
+		}
+
+		opts = append(opts, greetings.WithClock(func() time.Time { return now }), greetings.WithLocation(now.Location()))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := greetings.NewGreeter(opts...)
+	// A single worker is enough, since greeting is cheap, and it
+	// keeps the greetings picked with -seed reproducible.
+	results := g.Stream(ctx, names.names(ctx), greetings.StreamOptions{Workers: 1, Ordered: true, Locale: *locale})
+
+	out := bufio.NewWriter(stdout)
+	w := newWriter(out)
+	code := exitOK
+
+	// In strict mode, nothing is written until every name has
+	// been greeted, so that a failure leaves no partial output.
+	var held []greetings.Greeting
+
+	for result := range results {
+		if result.Err != nil {
+			logger.Printf("name #%d %q: %v", result.Index, result.Name, result.Err)
+			code = exitInvalidNames
+
+			if *strict {
+				return code
+			}
+
+			continue
+		}
+
+		if *strict {
+			held = append(held, result.Greeting())
+			continue
+		}
+
+		if err := w.Write(result.Greeting()); err != nil {
+			logger.Print(err)
+			return exitIO
+		}
+	}
+
+	if err := names.err(); err != nil {
+		logger.Print(err)
+		return exitIO
+	}
+
+	for _, greeting := range held {
+		if err := w.Write(greeting); err != nil {
+			logger.Print(err)
+			return exitIO
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		logger.Print(err)
+		return exitIO
+	}
+
+	if err := out.Flush(); err != nil {
+		logger.Print(err)
+		return exitIO
 	}
 
-	fmt.Println(message)
+	return code
 }
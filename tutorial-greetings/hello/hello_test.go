@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runHello runs the command with the given arguments and standard
+// input, returning the exit code and what was written.
+func runHello(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestHelloArgs(t *testing.T) {
+	args := []string{"-seed", "1", "-time", "2022-01-02T09:00:00Z", "-locale", "pt-BR", "Gladys", "Samantha"}
+	code, out, _ := runHello(t, "", args...)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	if code != exitOK || len(lines) != 2 || !strings.Contains(lines[0], "Gladys") || !strings.Contains(lines[1], "Samantha") {
+		t.Fatalf(`hello Gladys Samantha = %d, %q, want 0 and a line per name`, code, out)
+	}
+
+	// The same seed gives the same greetings at the same time.
+	if _, again, _ := runHello(t, "", args...); again != out {
+		t.Fatalf(`Seeded runs differ: %q != %q`, out, again)
+	}
+}
+
+func TestHelloStdin(t *testing.T) {
+	code, out, errOut := runHello(t, "Gladys\n\nSamantha\r\n\x07\nDarrin\n", "-format", "csv")
+	want := "name,message,format,locale\n"
+
+	if code != exitInvalidNames || !strings.HasPrefix(out, want) || strings.Count(out, "\n") != 4 {
+		t.Fatalf(`hello -format csv = %d, %q, want 1 and a header with 3 rows`, code, out)
+	}
+
+	if !strings.Contains(errOut, "name #2") {
+		t.Fatalf(`Expected the invalid name to be reported, got %q`, errOut)
+	}
+}
+
+func TestHelloFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.txt")
+	if err := os.WriteFile(path, []byte("Venat\nHades\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out, _ := runHello(t, "", "-file", path, "-format", "json")
+	if code != exitOK || !strings.HasPrefix(out, "[\n  {\"name\":\"Venat\"") || !strings.HasSuffix(out, "}\n]\n") {
+		t.Fatalf(`hello -file -format json = %d, %q, want 0 and a JSON array`, code, out)
+	}
+
+	if code, _, _ := runHello(t, "", "-file", filepath.Join(t.TempDir(), "missing.txt")); code != exitIO {
+		t.Fatalf(`hello -file with a missing file = %d, want %d`, code, exitIO)
+	}
+}
+
+func TestHelloStrict(t *testing.T) {
+	code, out, _ := runHello(t, "", "-strict", "-format", "yaml", "Venat", "", "Hades")
+	if code != exitInvalidNames || out != "" {
+		t.Fatalf(`hello -strict with an empty name = %d, %q, want 1 and no output`, code, out)
+	}
+
+	code, out, _ = runHello(t, "", "-strict", "-format", "yaml", "Venat")
+	if want := "- name: \"Venat\"\n"; code != exitOK || !strings.HasPrefix(out, want) {
+		t.Fatalf(`hello -strict -format yaml Venat = %d, %q, want 0 and %q first`, code, out, want)
+	}
+}
+
+func TestHelloUsage(t *testing.T) {
+	tests := [][]string{
+		{"-format", "xml", "Venat"},
+		{"-file", "names.txt", "Venat"},
+		{"-unknown"},
+	}
+
+	for _, args := range tests {
+		if code, _, _ := runHello(t, "", args...); code != exitUsage {
+			t.Errorf(`hello %q = %d, want %d`, args, code, exitUsage)
+		}
+	}
+
+	if code, out, _ := runHello(t, "", "-format", "json"); code != exitOK || out != "[]\n" {
+		t.Errorf(`hello -format json without names = %d, %q, want 0, "[]\n"`, code, out)
+	}
+}
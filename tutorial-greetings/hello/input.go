@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errNoNames is returned when there's nowhere to read names from.
+var errNoNames = errors.New("no names given; pass them as arguments, with -file or on the standard input")
+
+// nameSource is where the names to greet come from: either the
+// command-line arguments or a reader with one name per line.
+type nameSource struct {
+	args   []string
+	reader io.Reader
+
+	// readErr is set before the channel returned by names is
+	// closed, so it's safe to look at once that happened.
+	readErr error
+}
+
+// newNameSource picks the source of names from the arguments or,
+// without any, from the reader, which is the -file or the standard
+// input. The standard input is only used when it isn't a terminal,
+// so that running the command without any name doesn't hang waiting
+// for one.
+func newNameSource(args []string, file string, input io.Reader) (*nameSource, error) {
+	if len(args) > 0 {
+		return &nameSource{args: args}, nil
+	}
+
+	if file == "" && isTerminal(input) {
+		return nil, errNoNames
+	}
+
+	return &nameSource{reader: input}, nil
+}
+
+// names sends every name on the returned channel, then closes it.
+// Empty lines are skipped.
+func (s *nameSource) names(ctx context.Context) <-chan string {
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+
+		send := func(name string) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- name:
+				return true
+			}
+		}
+
+		if s.reader == nil {
+			for _, name := range s.args {
+				if !send(name) {
+					return
+				}
+			}
+
+			return
+		}
+
+		scanner := bufio.NewScanner(s.reader)
+		for scanner.Scan() {
+			name := strings.TrimSuffix(scanner.Text(), "\r")
+			if name == "" {
+				continue
+			}
+
+			if !send(name) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			s.readErr = fmt.Errorf("reading names: %v", err)
+		}
+	}()
+
+	return ch
+}
+
+// err returns the error that stopped reading names, if any.
+func (s *nameSource) err() error {
+	return s.readErr
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
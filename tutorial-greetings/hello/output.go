@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"example.com/greetings"
+)
+
+// greetingWriter writes greetings in one of the output formats.
+// Close must be called once every greeting has been written.
+type greetingWriter interface {
+	Write(greeting greetings.Greeting) error
+	Close() error
+}
+
+// writers maps the values of the -format flag to their writers.
+var writers = map[string]func(w io.Writer) greetingWriter{
+	"text": func(w io.Writer) greetingWriter { return &textWriter{w: w} },
+	"json": func(w io.Writer) greetingWriter { return &jsonWriter{w: w} },
+	"csv":  func(w io.Writer) greetingWriter { return newCSVWriter(w) },
+	"yaml": func(w io.Writer) greetingWriter { return &yamlWriter{w: w} },
+}
+
+// textWriter writes one message per line.
+type textWriter struct {
+	w io.Writer
+}
+
+func (t *textWriter) Write(greeting greetings.Greeting) error {
+	_, err := fmt.Fprintln(t.w, greeting.Message)
+	return err
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+// jsonWriter writes a JSON array of greetings. It writes the array
+// piece by piece rather than all at once, so that greetings show
+// up as soon as they're ready.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(greeting greetings.Greeting) error {
+	content, err := json.Marshal(greeting)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if j.count == 0 {
+		sep = "[\n  "
+	}
+
+	j.count++
+	_, err = fmt.Fprintf(j.w, "%s%s", sep, content)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if j.count == 0 {
+		_, err := fmt.Fprintln(j.w, "[]")
+		return err
+	}
+
+	_, err := fmt.Fprintln(j.w, "\n]")
+	return err
+}
+
+// csvWriter writes a header row followed by a row per greeting.
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(greeting greetings.Greeting) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+
+	return c.w.Write([]string{greeting.Name, greeting.Message, greeting.Format, greeting.Locale})
+}
+
+func (c *csvWriter) Close() error {
+	// The header is written even when there's nothing else.
+	if err := c.header(); err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) header() error {
+	if c.wroteHeader {
+		return nil
+	}
+
+	c.wroteHeader = true
+	return c.w.Write([]string{"name", "message", "format", "locale"})
+}
+
+// yamlWriter writes a YAML sequence of greetings. Strings are
+// written as JSON strings, which YAML reads as double-quoted
+// scalars, so there's no need for a YAML library.
+type yamlWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (y *yamlWriter) Write(greeting greetings.Greeting) error {
+	y.count++
+
+	fields := []struct {
+		key   string
+		value string
+	}{
+		{"name", greeting.Name},
+		{"message", greeting.Message},
+		{"format", greeting.Format},
+		{"locale", greeting.Locale},
+	}
+
+	for idx, field := range fields {
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+
+		prefix := "  "
+		if idx == 0 {
+			prefix = "- "
+		}
+
+		if _, err := fmt.Fprintf(y.w, "%s%s: %s\n", prefix, field.key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (y *yamlWriter) Close() error {
+	if y.count == 0 {
+		_, err := fmt.Fprintln(y.w, "[]")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/greetings"
+)
+
+func main() {
+	log.SetPrefix("greetings: ")
+	log.SetFlags(0)
+
+	addr := flag.String("addr", "localhost:8081", "`address` to listen on")
+	seed := flag.Int64("seed", 0, "pick greetings reproducibly using this `seed`")
+	flag.Parse()
+
+	var opts []greetings.Option
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			opts = append(opts, greetings.WithSeed(*seed))
+		}
+	})
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServer(greetings.NewGreeter(opts...)),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(srv.ListenAndServe())
+}
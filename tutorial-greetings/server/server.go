@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/greetings"
+)
+
+// maxBodyBytes caps the size of POST /hellos bodies.
+const maxBodyBytes = 1 << 20
+
+// The media types the server can respond with.
+const (
+	mediaJSON = "application/json"
+	mediaText = "text/plain"
+)
+
+// server exposes a Greeter over HTTP.
+type server struct {
+	greeter *greetings.Greeter
+}
+
+// hellosRequest is the body of POST /hellos.
+type hellosRequest struct {
+	Names  []string `json:"names"`
+	Locale string   `json:"locale"`
+}
+
+// errorBody is the body of every error response.
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Names lists the names that couldn't be greeted, if any.
+	Names []nameErrorDetail `json:"names,omitempty"`
+}
+
+type nameErrorDetail struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorCodes maps the greetings errors to the codes used in
+// error responses. Anything else is an internal error.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{greetings.ErrEmptyName, "empty_name"},
+	{greetings.ErrNameTooLong, "name_too_long"},
+	{greetings.ErrInvalidCharacters, "invalid_characters"},
+	{greetings.ErrDuplicateName, "duplicate_name"},
+	{greetings.ErrUnknownLocale, "unknown_locale"},
+}
+
+func newServer(greeter *greetings.Greeter) http.Handler {
+	s := &server{greeter: greeter}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", s.hello)
+	mux.HandleFunc("/hellos", s.hellos)
+
+	return mux
+}
+
+// hello handles GET /hello?name=...&locale=...
+func (s *server) hello(w http.ResponseWriter, r *http.Request) {
+	media, ok := negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, media, "GET, HEAD")
+		return
+	}
+
+	query := r.URL.Query()
+	list, err := s.greet(r, []string{query.Get("name")}, query.Get("locale"))
+	if err != nil {
+		writeError(w, media, err)
+		return
+	}
+
+	if media == mediaText {
+		writeText(w, http.StatusOK, list[0].Message)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list[0])
+}
+
+// hellos handles POST /hellos with a JSON body like
+// {"names": ["Gladys", "Samantha"], "locale": "pt-BR"}.
+func (s *server) hellos(w http.ResponseWriter, r *http.Request) {
+	media, ok := negotiate(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, media, "POST")
+		return
+	}
+
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mediaJSON {
+		writeErrorDetail(w, media, http.StatusUnsupportedMediaType, errorDetail{
+			Code:    "unsupported_media_type",
+			Message: "the request body must be " + mediaJSON,
+		})
+		return
+	}
+
+	var body hellosRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		writeErrorDetail(w, media, http.StatusBadRequest, errorDetail{
+			Code:    "invalid_body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	list, err := s.greet(r, body.Names, body.Locale)
+	if err != nil {
+		writeError(w, media, err)
+		return
+	}
+
+	if media == mediaText {
+		messages := make([]string, len(list))
+		for idx, greeting := range list {
+			messages[idx] = greeting.Message
+		}
+
+		writeText(w, http.StatusOK, strings.Join(messages, "\n"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]greetings.Greeting{"greetings": list})
+}
+
+// greet greets every name, stopping early if the client goes away.
+// Unless every name was greeted, it returns a *greetings.BatchError
+// listing the ones that weren't.
+func (s *server) greet(r *http.Request, names []string, locale string) ([]greetings.Greeting, error) {
+	idx := 0
+	next := func() (string, bool) {
+		if idx == len(names) {
+			return "", false
+		}
+
+		idx++
+		return names[idx-1], true
+	}
+
+	list := make([]greetings.Greeting, 0, len(names))
+	var failed []*greetings.NameError
+
+	// A single worker keeps the greetings reproducible with -seed.
+	opts := greetings.StreamOptions{Workers: 1, Ordered: true, Locale: locale}
+
+	for result := range s.greeter.StreamFunc(r.Context(), next, opts) {
+		if result.Err != nil {
+			failed = append(failed, &greetings.NameError{Index: result.Index, Name: result.Name, Err: result.Err})
+			continue
+		}
+
+		list = append(list, result.Greeting())
+	}
+
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	if len(failed) > 0 {
+		return nil, &greetings.BatchError{Errors: failed}
+	}
+
+	return list, nil
+}
+
+// negotiate picks the media type to respond with from the Accept
+// header, preferring JSON. If neither JSON nor plain text is
+// acceptable, it responds with 406 Not Acceptable itself.
+func negotiate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return mediaJSON, true
+	}
+
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		var candidate string
+		var specificity int
+
+		switch media {
+		case "*/*":
+			candidate, specificity = mediaJSON, 0
+		case "application/*":
+			candidate, specificity = mediaJSON, 1
+		case "text/*":
+			candidate, specificity = mediaText, 1
+		case mediaJSON, mediaText:
+			candidate, specificity = media, 2
+		default:
+			continue
+		}
+
+		// Higher quality wins, then the more specific media range.
+		if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = candidate, q, specificity
+		}
+	}
+
+	if bestQ == 0 {
+		writeErrorDetail(w, mediaJSON, http.StatusNotAcceptable, errorDetail{
+			Code:    "not_acceptable",
+			Message: fmt.Sprintf("responses are available as %s or %s", mediaJSON, mediaText),
+		})
+		return "", false
+	}
+
+	return best, true
+}
+
+func methodNotAllowed(w http.ResponseWriter, media, allow string) {
+	w.Header().Set("Allow", allow)
+	writeErrorDetail(w, media, http.StatusMethodNotAllowed, errorDetail{
+		Code:    "method_not_allowed",
+		Message: "allowed methods: " + allow,
+	})
+}
+
+// writeError maps err to a status code and an error body. Errors
+// from the greetings package are the client's fault.
+func writeError(w http.ResponseWriter, media string, err error) {
+	var batchErr *greetings.BatchError
+	if !errors.As(err, &batchErr) {
+		writeErrorDetail(w, media, http.StatusInternalServerError, errorDetail{
+			Code:    "internal",
+			Message: http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	detail := errorDetail{
+		Code:    "invalid_names",
+		Message: fmt.Sprintf("%d name(s) couldn't be greeted", len(batchErr.Errors)),
+	}
+
+	for _, nameErr := range batchErr.Errors {
+		code := "internal"
+		for _, known := range errorCodes {
+			if errors.Is(nameErr.Err, known.err) {
+				code = known.code
+				break
+			}
+		}
+
+		detail.Names = append(detail.Names, nameErrorDetail{
+			Index:   nameErr.Index,
+			Name:    nameErr.Name,
+			Code:    code,
+			Message: nameErr.Err.Error(),
+		})
+	}
+
+	// A single name is reported as is, rather than as a batch.
+	if len(detail.Names) == 1 {
+		detail.Code = detail.Names[0].Code
+		detail.Message = detail.Names[0].Message
+	}
+
+	writeErrorDetail(w, media, http.StatusBadRequest, detail)
+}
+
+func writeErrorDetail(w http.ResponseWriter, media string, status int, detail errorDetail) {
+	if media != mediaText {
+		writeJSON(w, status, errorBody{Error: detail})
+		return
+	}
+
+	lines := []string{fmt.Sprintf("%s: %s", detail.Code, detail.Message)}
+	for _, name := range detail.Names {
+		lines = append(lines, fmt.Sprintf("name #%d %q: %s: %s", name.Index, name.Name, name.Code, name.Message))
+	}
+
+	writeText(w, status, strings.Join(lines, "\n"))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaJSON+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(content, '\n'))
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", mediaText+"; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, text+"\n")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/greetings"
+)
+
+// newTestServer returns a server whose greetings are predictable.
+func newTestServer() http.Handler {
+	night := func() time.Time { return time.Date(2022, 1, 2, 23, 0, 0, 0, time.UTC) }
+
+	return newServer(greetings.NewGreeter(
+		greetings.WithSelector(greetings.FixedSelector(0)),
+		greetings.WithClock(night),
+		greetings.WithLocation(time.UTC),
+	))
+}
+
+func serve(method, target, accept, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rec := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHello(t *testing.T) {
+	rec := serve("GET", "/hello?name=Gladys&locale=pt-BR", "", "")
+
+	var greeting greetings.Greeting
+	if err := json.Unmarshal(rec.Body.Bytes(), &greeting); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf(`GET /hello = %d, %q, want 200 and a greeting`, rec.Code, rec.Body)
+	}
+
+	want := greetings.Greeting{Name: "Gladys", Message: "Oi, Gladys. Seja bem-vindo!", Format: "Oi, %v. Seja bem-vindo!", Locale: "pt-BR"}
+	if greeting != want {
+		t.Fatalf(`GET /hello = %+v, want %+v`, greeting, want)
+	}
+}
+
+func TestHelloText(t *testing.T) {
+	rec := serve("GET", "/hello?name=Gladys", "text/plain, application/json;q=0.5", "")
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "Hi, Gladys. Welcome!\n" {
+		t.Fatalf(`GET /hello as text = %d, %q, want 200, "Hi, Gladys. Welcome!\n"`, rec.Code, rec.Body)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf(`GET /hello as text has Content-Type %q`, ct)
+	}
+
+	if rec := serve("GET", "/hello?name=Gladys", "image/png", ""); rec.Code != http.StatusNotAcceptable {
+		t.Fatalf(`GET /hello as an image = %d, want 406`, rec.Code)
+	}
+}
+
+func TestHelloInvalid(t *testing.T) {
+	rec := serve("GET", "/hello", "", "")
+
+	var body errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusBadRequest {
+		t.Fatalf(`GET /hello without a name = %d, %q, want 400 and an error`, rec.Code, rec.Body)
+	}
+
+	if body.Error.Code != "empty_name" || len(body.Error.Names) != 1 {
+		t.Fatalf(`GET /hello without a name returned %+v, want an empty_name error`, body.Error)
+	}
+
+	if rec := serve("DELETE", "/hello?name=Gladys", "", ""); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") == "" {
+		t.Fatalf(`DELETE /hello = %d, want 405 with Allow`, rec.Code)
+	}
+}
+
+func TestHellos(t *testing.T) {
+	rec := serve("POST", "/hellos", "", `{"names": ["Venat", "Hades", "Venat"], "locale": "fr"}`)
+
+	var body struct {
+		Greetings []greetings.Greeting `json:"greetings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf(`POST /hellos = %d, %q, want 200 and greetings`, rec.Code, rec.Body)
+	}
+
+	if len(body.Greetings) != 3 || body.Greetings[1].Message != "Salut, Hades. Bienvenue !" {
+		t.Fatalf(`POST /hellos returned %+v, want 3 greetings in order`, body.Greetings)
+	}
+}
+
+func TestHellosInvalid(t *testing.T) {
+	rec := serve("POST", "/hellos", "", `{"names": ["", "Hades", "Ha\u0007des"]}`)
+
+	var body errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusBadRequest {
+		t.Fatalf(`POST /hellos with invalid names = %d, %q, want 400 and an error`, rec.Code, rec.Body)
+	}
+
+	names := body.Error.Names
+	if body.Error.Code != "invalid_names" || len(names) != 2 || names[0].Code != "empty_name" || names[1].Index != 2 || names[1].Code != "invalid_characters" {
+		t.Fatalf(`POST /hellos with invalid names returned %+v`, body.Error)
+	}
+
+	tests := map[string]int{
+		`{"names": "Hades"}`:    http.StatusBadRequest,
+		`{"nmaes": ["Hades"]}`:  http.StatusBadRequest,
+		`{"names": ["Hades"]`:   http.StatusBadRequest,
+		`{"names": ["Hades"]} `: http.StatusOK,
+	}
+
+	for payload, want := range tests {
+		if rec := serve("POST", "/hellos", "", payload); rec.Code != want {
+			t.Errorf(`POST /hellos with %s = %d, want %d`, payload, rec.Code, want)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/hellos", strings.NewReader(`{"names": ["Hades"]}`))
+	rec = httptest.NewRecorder()
+	newTestServer().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf(`POST /hellos without a Content-Type = %d, want 415`, rec.Code)
+	}
+}
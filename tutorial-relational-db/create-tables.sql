@@ -2,28 +2,58 @@ DROP TABLE IF EXISTS characters;
 CREATE TABLE characters (
   id         	INT AUTO_INCREMENT NOT NULL,
   name      	VARCHAR(128) NOT NULL,
+  -- The name, case-folded and normalized to NFC, which
+  -- tutorial-restful-api keeps unique. Folding can make a name up
+  -- to three times as long.
+  name_key    VARCHAR(384) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
   role     		VARCHAR(255) NOT NULL,
   level      	INT NOT NULL,
-  PRIMARY KEY (`id`)
+  -- Used by tutorial-restful-api for ETags.
+  version    	INT NOT NULL DEFAULT 1,
+  -- The name of the account the character belongs to in
+  -- tutorial-restful-api.
+  owner       VARCHAR(128) NOT NULL DEFAULT 'admin',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (`name_key`)
 );
 
 INSERT INTO characters
-  (name, role, level)
+  (name, name_key, role, level)
 VALUES
-	('Hades', 'Emet-Selch', 99),
-	('Venat', 'Former Azem', 99),
-	('Hythlodaeus', 'Chief of the Bureau of the Architect', 99),
-	('Thancred', 'Scion', 80),
-	("Y'shtola", 'Scion', 80),
-	('Urianger', 'Scion', 80),
-	('Lyse', 'Ala Mhigan Resistance', 70);
+	('Hades', 'hades', 'Emet-Selch', 99),
+	('Venat', 'venat', 'Former Azem', 99),
+	('Hythlodaeus', 'hythlodaeus', 'Chief of the Bureau of the Architect', 99),
+	('Thancred', 'thancred', 'Scion', 80),
+	("Y'shtola", "y'shtola", 'Scion', 80),
+	('Urianger', 'urianger', 'Scion', 80),
+	('Lyse', 'lyse', 'Ala Mhigan Resistance', 70);
+
+DROP TABLE IF EXISTS character_revisions;
+-- Used by tutorial-restful-api to keep the history of the characters.
+CREATE TABLE character_revisions (
+  character_id  INT NOT NULL,
+  version       INT NOT NULL,
+  name          VARCHAR(128) NOT NULL,
+  role          VARCHAR(255) NOT NULL,
+  level         INT NOT NULL,
+  author        VARCHAR(128) NOT NULL,
+  changed_at    DATETIME(6) NOT NULL,
+  PRIMARY KEY (`character_id`, `version`)
+);
+
+INSERT INTO character_revisions
+  (character_id, version, name, role, level, author, changed_at)
+SELECT id, version, name, role, level, '', UTC_TIMESTAMP(6) FROM characters;
 
 DROP TABLE IF EXISTS accounts;
 CREATE TABLE accounts (
   id         						INT AUTO_INCREMENT NOT NULL,
   name      						VARCHAR(128) NOT NULL,
-  characters_remaining  INT NOT NULL,
-  PRIMARY KEY (`id`)
+  -- NULL means no limit. tutorial-restful-api sets it when removing
+  -- the quota of an account.
+  characters_remaining  INT,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (`name`)
 );
 
 INSERT INTO accounts
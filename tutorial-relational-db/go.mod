@@ -3,3 +3,5 @@ module example.com/relational-db
 go 1.17
 
 require github.com/go-sql-driver/mysql v1.6.0
+
+require golang.org/x/text v0.3.7
@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/go-sql-driver/mysql"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 )
 
+// maxRevisions is how many revisions of each character
+// tutorial-restful-api keeps.
+const maxRevisions = 100
+
 type Character struct {
 	// OK, apparently for models we need to have the first character uppercased.
 	ID    int    `json:"id"`
@@ -20,9 +27,22 @@ type Character struct {
 }
 
 type Account struct {
-	ID                  int    `json:"id"`
-	Name                string `json:"name"`
-	CharactersRemaining int    `json:"characters_remaining"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// CharactersRemaining is nil when the account has no limit, as
+	// tutorial-restful-api allows.
+	CharactersRemaining *int `json:"characters_remaining"`
+}
+
+// String prints the account as it was before CharactersRemaining
+// could be nil, e.g. {1 admin 1}, with "unlimited" for no limit.
+func (a Account) String() string {
+	remaining := "unlimited"
+	if a.CharactersRemaining != nil {
+		remaining = strconv.Itoa(*a.CharactersRemaining)
+	}
+
+	return fmt.Sprintf("{%d %s %s}", a.ID, a.Name, remaining)
 }
 
 func main() {
@@ -202,7 +222,7 @@ func getAccounts(db *sql.DB) ([]Account, error) {
 func getCharacters(db *sql.DB) ([]Character, error) {
 	var characters []Character
 
-	rows, err := db.Query("SELECT * from characters")
+	rows, err := db.Query("SELECT id, name, role, level from characters")
 	if err != nil {
 		return nil, fmt.Errorf("getCharacters: %v", err)
 	}
@@ -228,7 +248,7 @@ func getCharacters(db *sql.DB) ([]Character, error) {
 func getCharactersByRole(db *sql.DB, role string) ([]Character, error) {
 	var characters []Character
 
-	rows, err := db.Query("SELECT * from characters WHERE role=?", role)
+	rows, err := db.Query("SELECT id, name, role, level from characters WHERE role=?", role)
 	if err != nil {
 		return nil, fmt.Errorf("getCharactersByRole %q: %v", role, err)
 	}
@@ -254,7 +274,7 @@ func getCharactersByRole(db *sql.DB, role string) ([]Character, error) {
 func getCharacterById(db *sql.DB, id int) (Character, error) {
 	var char Character
 
-	row := db.QueryRow("SELECT * from characters WHERE id=?", id)
+	row := db.QueryRow("SELECT id, name, role, level from characters WHERE id=?", id)
 	if err := row.Scan(&char.ID, &char.Name, &char.Role, &char.Level); err != nil {
 		if err == sql.ErrNoRows {
 			return char, fmt.Errorf("getCharacterById %q: no matching character", id)
@@ -289,14 +309,18 @@ func addCharacter(db *sql.DB, ctx context.Context, char Character) (int64, error
 		}
 	}
 
-	if account.CharactersRemaining == 0 {
+	if account.ID == 0 {
+		return fail(fmt.Errorf("account admin not found"), "addCharacter")
+	}
+
+	if account.CharactersRemaining != nil && *account.CharactersRemaining == 0 {
 		return fail(fmt.Errorf("No characters creation allowed for admin"), "addCharacter")
 	}
 
 	// Check for character name existence.
 	var existingChar Character
 	err = tx.
-		QueryRowContext(ctx, "SELECT * from characters WHERE name=?", char.Name).
+		QueryRowContext(ctx, "SELECT id, name, role, level from characters WHERE name_key=?", nameKey(char.Name)).
 		Scan(&existingChar.ID, &existingChar.Name, &existingChar.Role, &existingChar.Level)
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -310,7 +334,7 @@ func addCharacter(db *sql.DB, ctx context.Context, char Character) (int64, error
 	}
 
 	// Insert.
-	result, err := tx.ExecContext(ctx, "INSERT INTO characters (name, role, level) VALUES (?, ?, ?)", char.Name, char.Role, char.Level)
+	result, err := tx.ExecContext(ctx, "INSERT INTO characters (name, name_key, role, level) VALUES (?, ?, ?, ?)", char.Name, nameKey(char.Name), char.Role, char.Level)
 	if err != nil {
 		return fail(err, "addCharacter")
 	}
@@ -320,8 +344,9 @@ func addCharacter(db *sql.DB, ctx context.Context, char Character) (int64, error
 		return fail(err, "addCharacter")
 	}
 
-	// Update number of characters allowed.
-	_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=? WHERE name=?", account.CharactersRemaining-1, "admin")
+	// Update number of characters allowed. NULL, for no limit, stays
+	// NULL.
+	_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=characters_remaining-1 WHERE name=?", "admin")
 	if err != nil {
 		return fail(err, "addCharacter")
 	}
@@ -333,20 +358,49 @@ func addCharacter(db *sql.DB, ctx context.Context, char Character) (int64, error
 	return id, nil
 }
 
+// nameKey returns what names are compared by: the name with its case
+// folded, normalized to NFC. It's a copy of nameKey in
+// tutorial-restful-api/store.go, which is a separate module, and must
+// stay the same as it, since both fill the name_key column.
+func nameKey(name string) string {
+	return norm.NFC.String(cases.Fold().String(norm.NFC.String(name)))
+}
+
 func updateCharacter(db *sql.DB, ctx context.Context, id int64, char Character) (int64, error) {
-	stmt, err := db.PrepareContext(ctx, "UPDATE characters SET name=?, role=?, level=? WHERE id=?")
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("updateCharacter: %v", err)
+		return fail(err, "updateCharacter")
 	}
+	defer tx.Rollback()
 
-	result, err := stmt.ExecContext(ctx, char.Name, char.Role, char.Level, id)
+	result, err := tx.ExecContext(ctx, "UPDATE characters SET name=?, name_key=?, role=?, level=?, version=version+1 WHERE id=?", char.Name, nameKey(char.Name), char.Role, char.Level, id)
 	if err != nil {
-		return 0, fmt.Errorf("updateCharacter: %v", err)
+		return fail(err, "updateCharacter")
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("updateCharacter: %v", err)
+		return fail(err, "updateCharacter")
+	}
+
+	// Record the new version in the history that tutorial-restful-api
+	// serves, which keeps the last maxRevisions of each character.
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO character_revisions (character_id, version, name, role, level, author, changed_at) SELECT id, version, name, role, level, ?, UTC_TIMESTAMP(6) FROM characters WHERE id=?",
+		"admin", id)
+	if err != nil {
+		return fail(err, "updateCharacter")
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM character_revisions WHERE character_id=? AND version<=(SELECT version FROM characters WHERE id=?)-?",
+		id, id, maxRevisions)
+	if err != nil {
+		return fail(err, "updateCharacter")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fail(err, "updateCharacter")
 	}
 
 	return rowsAffected, nil
@@ -382,7 +436,7 @@ func deleteCharacter(db *sql.DB, ctx context.Context, id int64) (int64, error) {
 	}
 
 	// Update number of characters allowed.
-	_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=? WHERE name=?", account.CharactersRemaining+1, "admin")
+	_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=characters_remaining+1 WHERE name=?", "admin")
 	if err != nil {
 		return fail(err, "deleteCharacter")
 	}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNoCredentials is returned by an Authenticator when the request
+// doesn't carry the kind of credentials it checks.
+var errNoCredentials = errors.New("no credentials")
+
+// Account is who a request is made by. It's the name of a row of the
+// accounts table in tutorial-relational-db.
+type Account struct {
+	Name string `json:"account"`
+	// Admin accounts can change every character, not only theirs.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// Authenticator finds out which account a request is made by.
+type Authenticator interface {
+	// Authenticate returns the account the credentials of the request
+	// belong to, or errNoCredentials if there are none it knows about.
+	// Any other error means that the credentials are invalid.
+	Authenticate(r *http.Request) (Account, error)
+}
+
+// withAuthenticator makes the server require credentials for the
+// requests that change characters, as checked by one of the given
+// authenticators. Without authenticators, anyone can change anything.
+func withAuthenticator(auth ...Authenticator) routerOption {
+	return func(s *server) {
+		s.authenticators = append(s.authenticators, auth...)
+	}
+}
+
+type accountKey struct{}
+
+// withAccount returns a context for requests made by account.
+func withAccount(ctx context.Context, account Account) context.Context {
+	return context.WithValue(ctx, accountKey{}, account)
+}
+
+// accountOf returns the account the requests made with ctx are made
+// by, if they were authenticated.
+func accountOf(ctx context.Context) (Account, bool) {
+	account, ok := ctx.Value(accountKey{}).(Account)
+	return account, ok
+}
+
+// authenticate finds out which account the request is made by, if it
+// carries credentials, and records it as the author of the changes.
+// Invalid credentials get a 401 Unauthorized, even for requests that
+// don't need any.
+func (s *server) authenticate(c *gin.Context) {
+	ctx := c.Request.Context()
+	author := c.ClientIP()
+
+	for _, auth := range s.authenticators {
+		account, err := auth.Authenticate(c.Request)
+		if err == errNoCredentials {
+			continue
+		}
+
+		if err != nil {
+			// The response doesn't say why, to not help guessing.
+			loggerOf(ctx).Info("Invalid credentials", "error", err)
+			if s.limitFailedAuth(c) {
+				unauthorized(c, "Invalid credentials")
+			}
+			return
+		}
+
+		ctx = withAccount(ctx, account)
+		author = account.Name
+		break
+	}
+
+	c.Request = c.Request.WithContext(withAuthor(ctx, author))
+}
+
+// requireAccount makes sure that the request was authenticated, if the
+// server checks credentials at all.
+func (s *server) requireAccount(c *gin.Context) {
+	if _, ok := accountOf(c.Request.Context()); !ok && len(s.authenticators) > 0 {
+		unauthorized(c, "Credentials are required")
+	}
+}
+
+// requireAdmin makes sure that the request was made by an admin, if
+// the server checks credentials at all.
+func (s *server) requireAdmin(c *gin.Context) {
+	if len(s.authenticators) == 0 {
+		return
+	}
+
+	account, ok := accountOf(c.Request.Context())
+	switch {
+	case !ok:
+		unauthorized(c, "Credentials are required")
+	case !account.Admin:
+		c.IndentedJSON(http.StatusForbidden, errorDocument{Message: "Only admins may do this"})
+		c.Abort()
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="characters"`)
+	c.IndentedJSON(http.StatusUnauthorized, errorDocument{Message: message})
+	c.Abort()
+}
+
+// authorize returns the check that the account making the requests of
+// ctx may change a character: admins may change any, and others only
+// their own. Without an account, there's nothing to check.
+func authorize(ctx context.Context) CheckFunc {
+	account, ok := accountOf(ctx)
+	if !ok || account.Admin {
+		return nil
+	}
+
+	return func(current Character) error {
+		if current.Owner == account.Name {
+			return nil
+		}
+
+		return &clientError{
+			status: http.StatusForbidden,
+			doc:    errorDocument{Message: "The character belongs to another account"},
+		}
+	}
+}
+
+// checkWrite returns the check of a request changing a character: it
+// must be allowed to, and match the If-Match header. Like ifMatch, it
+// responds itself and returns false if the request can't go on.
+func (s *server) checkWrite(c *gin.Context) (CheckFunc, bool) {
+	check, ok := s.ifMatch(c)
+	return allOf(authorize(c.Request.Context()), check), ok
+}
+
+// ownerFor returns the owner of a character created with ctx, which
+// asked for the given one. Only admins can create characters for
+// other accounts.
+func ownerFor(ctx context.Context, requested string) string {
+	account, ok := accountOf(ctx)
+	switch {
+	case !ok:
+		return requested
+	case account.Admin && requested != "":
+		return requested
+	default:
+		return account.Name
+	}
+}
+
+// apiKeys authenticates requests by the API key in their X-API-Key
+// header.
+type apiKeys struct {
+	// accounts is keyed by the SHA-256 of the keys, so that looking
+	// them up doesn't leak how much of a key is right.
+	accounts map[[sha256.Size]byte]Account
+}
+
+// newAPIKeys returns an authenticator for the given keys.
+func newAPIKeys(keys map[string]Account) *apiKeys {
+	a := &apiKeys{accounts: make(map[[sha256.Size]byte]Account, len(keys))}
+	for key, account := range keys {
+		a.accounts[sha256.Sum256([]byte(key))] = account
+	}
+
+	return a
+}
+
+// loadAPIKeys reads the keys from a JSON file such as
+// `{"<key>": {"account": "admin", "admin": true}}`.
+func loadAPIKeys(path string) (*apiKeys, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadAPIKeys: %v", err)
+	}
+
+	var keys map[string]Account
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("loadAPIKeys: %s: %v", path, err)
+	}
+
+	for _, account := range keys {
+		if account.Name == "" {
+			return nil, fmt.Errorf("loadAPIKeys: %s: a key has no account", path)
+		}
+	}
+
+	return newAPIKeys(keys), nil
+}
+
+func (a *apiKeys) Authenticate(r *http.Request) (Account, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return Account{}, errNoCredentials
+	}
+
+	account, ok := a.accounts[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Account{}, errors.New("unknown API key")
+	}
+
+	return account, nil
+}
+
+// tokenClaims is the payload of a bearer token.
+type tokenClaims struct {
+	// Subject is the name of the account.
+	Subject string `json:"sub"`
+	Admin   bool   `json:"admin,omitempty"`
+	// ExpiresAt is in seconds since the Unix epoch.
+	ExpiresAt int64 `json:"exp"`
+}
+
+// tokenHeader is the header of every token: they're JSON Web Tokens
+// signed with HMAC-SHA256, so that the usual tools can read them.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// tokens authenticates requests by the bearer token in their
+// Authorization header, which must be signed with the secret.
+type tokens struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func newTokens(secret []byte) *tokens {
+	return &tokens{secret: secret, now: time.Now}
+}
+
+// sign returns a token for the claims.
+func (t *tokens) sign(claims tokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(t.mac(unsigned)), nil
+}
+
+func (t *tokens) mac(unsigned string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func (t *tokens) Authenticate(r *http.Request) (Account, error) {
+	// The scheme is case-insensitive, as in RFC 7235.
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "Bearer") {
+		return Account{}, errNoCredentials
+	}
+
+	if len(fields) != 2 {
+		return Account{}, errors.New("malformed token")
+	}
+	token := fields[1]
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Account{}, errors.New("malformed token")
+	}
+
+	// Only accept the header we sign with, so that nobody gets to
+	// pick the algorithm, e.g. "none".
+	if parts[0] != tokenHeader {
+		return Account{}, errors.New("unsupported token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.mac(parts[0]+"."+parts[1])) {
+		return Account{}, errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Account{}, err
+	}
+
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Account{}, err
+	}
+
+	if claims.Subject == "" {
+		return Account{}, errors.New("token without a subject")
+	}
+
+	if t.now().Unix() >= claims.ExpiresAt {
+		return Account{}, errors.New("expired token")
+	}
+
+	return Account{Name: claims.Subject, Admin: claims.Admin}, nil
+}
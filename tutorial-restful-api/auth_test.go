@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTokens signs tokens with a fixed secret, at a fixed time.
+func testTokens() *tokens {
+	t := newTokens([]byte("secret"))
+	t.now = func() time.Time { return time.Unix(1e9, 0) }
+	return t
+}
+
+// bearer returns the Authorization header of a token for the account.
+func bearer(t *testing.T, name string, admin bool) map[string]string {
+	t.Helper()
+
+	token, err := testTokens().sign(tokenClaims{Subject: name, Admin: admin, ExpiresAt: 1e9 + 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func TestTokens(t *testing.T) {
+	auth := testTokens()
+	token, _ := auth.sign(tokenClaims{Subject: "alisaie", ExpiresAt: 1e9 + 60})
+	expired, _ := auth.sign(tokenClaims{Subject: "alisaie", ExpiresAt: 1e9})
+	forged, _ := newTokens([]byte("guess")).sign(tokenClaims{Subject: "admin", Admin: true, ExpiresAt: 1e9 + 60})
+	parts := strings.Split(token, ".")
+	unsigned := strings.Join([]string{"eyJhbGciOiJub25lIn0", parts[1], ""}, ".")
+
+	tests := []struct {
+		header string
+		want   string
+		err    bool
+	}{
+		{"Bearer " + token, "alisaie", false},
+		{"bearer " + token, "alisaie", false},
+		{"BEARER  " + token, "alisaie", false},
+		{"Bearer", "", true},
+		{"", "", false},
+		{"Basic YWxpc2FpZTo=", "", false},
+		{"Bearer " + expired, "", true},
+		{"Bearer " + forged, "", true},
+		{"Bearer " + unsigned, "", true},
+		{"Bearer " + token[:len(token)-2], "", true},
+		{"Bearer nonsense", "", true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/characters", nil)
+		req.Header.Set("Authorization", test.header)
+
+		account, err := auth.Authenticate(req)
+		if account.Name != test.want || (err != nil && err != errNoCredentials) != test.err {
+			t.Errorf(`Authenticate with %q = %+v, %v, want %q`, test.header, account, err, test.want)
+		}
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(`{"k1": {"account": "admin", "admin": true}, "k2": {"account": "alisaie"}}`), 0o600)
+
+	keys, err := loadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]Account{"k1": {Name: "admin", Admin: true}, "k2": {Name: "alisaie"}} {
+		req := httptest.NewRequest("GET", "/characters", nil)
+		req.Header.Set("X-API-Key", key)
+		if got, err := keys.Authenticate(req); got != want || err != nil {
+			t.Errorf(`Authenticate with key %q = %+v, %v, want %+v`, key, got, err, want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/characters", nil)
+	req.Header.Set("X-API-Key", "k3")
+	if _, err := keys.Authenticate(req); err == nil || err == errNoCredentials {
+		t.Errorf(`Authenticate with an unknown key returned %v, want an error`, err)
+	}
+
+	os.WriteFile(path, []byte(`{"k1": {"admin": true}}`), 0o600)
+	if _, err := loadAPIKeys(path); err == nil {
+		t.Errorf(`loadAPIKeys of a key without an account returned no error`)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	keys := newAPIKeys(map[string]Account{"alphinaud-key": {Name: "alphinaud"}})
+	router := newRouter(newMemoryStore(seedCharacters...), withAuthenticator(testTokens(), keys))
+	hades := "/characters/" + seedCharacters[0].ID
+	alisaie := bearer(t, "alisaie", false)
+	body := `{"name": "Hades", "role": "Emet-Selch", "level": 90}`
+
+	if rec := do(router, "GET", hades, ""); rec.Code != http.StatusOK {
+		t.Fatalf(`GET %s without credentials = %d, want 200`, hades, rec.Code)
+	}
+
+	if rec := doWith(router, "GET", hades, "", map[string]string{"Authorization": "Bearer nonsense"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf(`GET %s with invalid credentials = %d, want 401`, hades, rec.Code)
+	}
+
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		target := hades
+		if method == "POST" {
+			target = "/characters"
+		}
+
+		rec := do(router, method, target, body)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf(`%s %s without credentials = %d, want 401`, method, target, rec.Code)
+		}
+	}
+
+	// Characters belong to whoever creates them, whatever they ask for.
+	rec := doWith(router, "POST", "/characters", `{"name": "Alisaie", "level": 80, "owner": "admin"}`, alisaie)
+	var created Character
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated || created.Owner != "alisaie" {
+		t.Fatalf(`POST /characters = %d, %s, want a character owned by alisaie`, rec.Code, rec.Body)
+	}
+
+	if rec := doWith(router, "PUT", hades, body, alisaie); rec.Code != http.StatusForbidden {
+		t.Fatalf(`PUT %s by another account = %d, want 403`, hades, rec.Code)
+	}
+
+	if rec := doWith(router, "DELETE", "/characters/"+created.ID, "", map[string]string{"X-API-Key": "alphinaud-key"}); rec.Code != http.StatusForbidden {
+		t.Fatalf(`DELETE /characters/%s by another account = %d, want 403`, created.ID, rec.Code)
+	}
+
+	rec = doWith(router, "GET", "/characters/"+created.ID+"/revisions", "", nil)
+	if !strings.Contains(rec.Body.String(), `"author": "alisaie"`) {
+		t.Fatalf(`GET /characters/%s/revisions = %s, want alisaie as the author`, created.ID, rec.Body)
+	}
+
+	rec = doWith(router, "PATCH", "/characters/"+created.ID, `{"level": 90}`, map[string]string{"Authorization": alisaie["Authorization"], "Content-Type": mediaMergePatch})
+	if rec.Code != http.StatusOK {
+		t.Fatalf(`PATCH /characters/%s by its owner = %d, %s, want 200`, created.ID, rec.Code, rec.Body)
+	}
+
+	if rec := doWith(router, "DELETE", "/characters/"+created.ID, "", bearer(t, "admin", true)); rec.Code != http.StatusOK {
+		t.Fatalf(`DELETE /characters/%s by an admin = %d, want 200`, created.ID, rec.Code)
+	}
+
+	rec = doWith(router, "POST", "/characters:batch", `{"operations": [
+		{"op": "create", "character": {"name": "Alisaie", "level": 80}},
+		{"op": "delete", "id": "`+seedCharacters[1].ID+`"}
+	]}`, alisaie)
+	var batch batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil || batch.Results[0].Character.Owner != "alisaie" || batch.Results[1].Status != http.StatusForbidden {
+		t.Fatalf(`POST /characters:batch = %d, %s, want Alisaie created and the deletion forbidden`, rec.Code, rec.Body)
+	}
+
+	rec = do(router, "GET", "/characters?owner=alisaie", "")
+	var page listPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || names(page.Characters) != "Alisaie" {
+		t.Fatalf(`GET /characters?owner=alisaie = %s, want Alisaie`, rec.Body)
+	}
+}
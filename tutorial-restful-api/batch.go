@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchOperations caps the number of operations in a batch.
+const maxBatchOperations = 1000
+
+// batchRequest is the body of POST /characters:batch.
+type batchRequest struct {
+	// Atomic makes the operations succeed or fail as a whole.
+	// Otherwise, each one succeeds or fails on its own.
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchOperation does what the request of the same name would:
+// create is POST /characters, update is PUT /characters/:id and
+// delete is DELETE /characters/:id.
+type batchOperation struct {
+	Op string `json:"op"`
+	ID string `json:"id"`
+	// IfMatch is the If-Match header of the request.
+	IfMatch   string     `json:"ifMatch"`
+	Character *Character `json:"character"`
+}
+
+// batchResult is what the request of an operation would have gotten.
+type batchResult struct {
+	Status    int            `json:"status"`
+	Character *Character     `json:"character,omitempty"`
+	Error     *errorDocument `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	// Results are in the order of the operations.
+	Results []batchResult `json:"results"`
+}
+
+// characterAction handles POST /characters:<action>. gin can't route
+// on part of a path segment, so the route matches every path that
+// starts with /characters, and the action includes the colon.
+func (s *server) characterAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":batch":
+		s.batchCharacters(c)
+	default:
+		c.IndentedJSON(http.StatusNotFound, errorDocument{Message: "Not found"})
+	}
+}
+
+// batchCharacters handles POST /characters:batch, which runs many
+// operations in a single request. A best-effort batch always gets a
+// 200 OK, whatever the results. An atomic one that fails gets the
+// status of the operation that failed, while the others get a 424
+// Failed Dependency.
+func (s *server) batchCharacters(c *gin.Context) {
+	var req batchRequest
+	if !decodeBody(c, &req) {
+		return
+	}
+
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		c.IndentedJSON(http.StatusBadRequest, errorDocument{
+			Message: "Invalid batch",
+			Errors: []fieldError{{
+				Field:   "operations",
+				Message: fmt.Sprintf("must hold between 1 and %d operations", maxBatchOperations),
+			}},
+		})
+		return
+	}
+
+	creates := 0
+	for _, op := range req.Operations {
+		if op.Op == opCreate {
+			creates++
+		}
+	}
+
+	// Batches would otherwise get around the limit on creates.
+	if !s.limitCreates(c, creates) {
+		return
+	}
+
+	ops := make([]Operation, len(req.Operations))
+	results := make([]batchResult, len(req.Operations))
+	for idx, op := range req.Operations {
+		var err error
+		if ops[idx], err = s.prepare(c.Request.Context(), op); err != nil {
+			results[idx] = errorResult(c, err)
+		}
+	}
+
+	if req.Atomic {
+		s.applyAtomically(c, ops, results)
+		return
+	}
+
+	for idx, op := range ops {
+		if results[idx].Error != nil {
+			continue
+		}
+
+		char, err := s.applyOne(c.Request.Context(), op)
+		if err != nil {
+			results[idx] = errorResult(c, err)
+			continue
+		}
+
+		results[idx] = successResult(op, char)
+	}
+
+	c.IndentedJSON(http.StatusOK, batchResponse{Results: results})
+}
+
+// applyAtomically applies every operation, unless one of them already
+// failed to be prepared, as its result says.
+func (s *server) applyAtomically(c *gin.Context, ops []Operation, results []batchResult) {
+	prepared := true
+	for _, result := range results {
+		if result.Error != nil {
+			prepared = false
+		}
+	}
+
+	if prepared {
+		chars, err := s.store.Apply(c.Request.Context(), ops)
+		var opErr *OperationError
+		switch {
+		case errors.As(err, &opErr):
+			results[opErr.Index] = errorResult(c, opErr.Err)
+		case err != nil:
+			respondWithError(c, err)
+			return
+		default:
+			for idx, op := range ops {
+				results[idx] = successResult(op, chars[idx])
+			}
+
+			c.IndentedJSON(http.StatusOK, batchResponse{Results: results})
+			return
+		}
+	}
+
+	// None of the operations were applied.
+	status := 0
+	for idx, result := range results {
+		if result.Error != nil {
+			if status == 0 {
+				status = result.Status
+			}
+
+			continue
+		}
+
+		results[idx] = batchResult{
+			Status: http.StatusFailedDependency,
+			Error:  &errorDocument{Message: "Not applied, since another operation failed"},
+		}
+	}
+
+	c.IndentedJSON(status, batchResponse{Results: results})
+}
+
+// applyOne applies op on its own, as its request would.
+func (s *server) applyOne(ctx context.Context, op Operation) (Character, error) {
+	switch op.Op {
+	case opCreate:
+		return s.store.Create(ctx, op.Character)
+	case opUpdate:
+		return s.store.Update(ctx, op.ID, op.Update)
+	default:
+		return Character{}, s.store.Delete(ctx, op.ID, op.Check)
+	}
+}
+
+// prepare turns op into an operation for the store, made by the
+// account of ctx. Invalid operations get a *clientError for a 400 Bad
+// Request, and invalid characters one for a 422 Unprocessable Entity,
+// as their requests would.
+func (s *server) prepare(ctx context.Context, op batchOperation) (Operation, error) {
+	var errs []fieldError
+	switch op.Op {
+	case opCreate, opUpdate, opDelete:
+	default:
+		errs = append(errs, fieldError{Field: "op", Message: fmt.Sprintf("must be %s, %s or %s", opCreate, opUpdate, opDelete)})
+	}
+
+	if op.ID == "" && (op.Op == opUpdate || op.Op == opDelete) {
+		errs = append(errs, fieldError{Field: "id", Message: "is required"})
+	}
+
+	if op.Character == nil && (op.Op == opCreate || op.Op == opUpdate) {
+		errs = append(errs, fieldError{Field: "character", Message: "is required"})
+	}
+
+	if len(errs) > 0 {
+		return Operation{}, &clientError{status: http.StatusBadRequest, doc: errorDocument{Message: "Invalid operation", Errors: errs}}
+	}
+
+	if op.Op == opCreate {
+		char := *op.Character
+		char.Owner = ownerFor(ctx, char.Owner)
+		return Operation{Op: opCreate, Character: char}, checkCharacter(char)
+	}
+
+	check, err := s.precondition(op.IfMatch)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	check = allOf(authorize(ctx), check)
+
+	if op.Op == opDelete {
+		return Operation{Op: opDelete, ID: op.ID, Check: check}, nil
+	}
+
+	// The store makes sure that the ID is kept, as with PUT.
+	update := guard(check, replaceWith(*op.Character))
+	return Operation{Op: opUpdate, ID: op.ID, Update: update}, checkCharacter(*op.Character)
+}
+
+// successResult returns the result of an operation that went through.
+func successResult(op Operation, char Character) batchResult {
+	switch op.Op {
+	case opCreate:
+		return batchResult{Status: http.StatusCreated, Character: &char}
+	case opUpdate:
+		return batchResult{Status: http.StatusOK, Character: &char}
+	default:
+		return batchResult{Status: http.StatusOK}
+	}
+}
+
+// errorResult returns the result of an operation that failed.
+func errorResult(c *gin.Context, err error) batchResult {
+	status, doc := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		c.Error(err)
+	}
+
+	return batchResult{Status: status, Error: &doc}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBatchBestEffort(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	hades, venat := seedCharacters[0], seedCharacters[1]
+
+	rec := do(router, "POST", "/characters:batch", `{"operations": [
+		{"op": "create", "character": {"name": "Themis", "role": "Elidibus", "level": 99}},
+		{"op": "update", "id": "`+hades.ID+`", "ifMatch": "\"1\"", "character": {"name": "Hades", "role": "Emet-Selch", "level": 90}},
+		{"op": "update", "id": "`+venat.ID+`", "ifMatch": "\"7\"", "character": {"name": "Venat", "level": 1}},
+		{"op": "delete", "id": "unknown"},
+		{"op": "create", "character": {"name": ""}},
+		{"op": "rename"}
+	]}`)
+
+	var body batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK || len(body.Results) != 6 {
+		t.Fatalf(`POST /characters:batch = %d, %s, want 200 and 6 results`, rec.Code, rec.Body)
+	}
+
+	for idx, want := range []int{201, 200, 412, 404, 422, 400} {
+		if got := body.Results[idx].Status; got != want {
+			t.Errorf(`Result %d has status %d, want %d`, idx, got, want)
+		}
+	}
+
+	if char := body.Results[1].Character; char == nil || char.Level != 90 || char.Version != 2 {
+		t.Errorf(`Result 1 = %+v, want Hades updated`, body.Results[1])
+	}
+
+	rec = do(router, "GET", "/characters?limit=100", "")
+	var page listPage
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if page.Total != 4 {
+		t.Fatalf(`GET /characters after the batch = %s, want Themis created`, rec.Body)
+	}
+}
+
+func TestBatchAtomic(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	hades, venat := seedCharacters[0], seedCharacters[1]
+
+	rec := do(router, "POST", "/characters:batch", `{"atomic": true, "operations": [
+		{"op": "create", "character": {"name": "Themis", "role": "Elidibus", "level": 99}},
+		{"op": "update", "id": "`+hades.ID+`", "character": {"name": "Hades", "role": "Emet-Selch", "level": 90}},
+		{"op": "delete", "id": "`+venat.ID+`", "ifMatch": "\"2\""}
+	]}`)
+
+	var body batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusPreconditionFailed || len(body.Results) != 3 {
+		t.Fatalf(`POST /characters:batch = %d, %s, want 412 and 3 results`, rec.Code, rec.Body)
+	}
+
+	for idx, want := range []int{424, 424, 412} {
+		if got := body.Results[idx].Status; got != want {
+			t.Errorf(`Result %d has status %d, want %d`, idx, got, want)
+		}
+	}
+
+	if rec := do(router, "GET", "/characters/"+hades.ID, ""); rec.Header().Get("ETag") != `"1"` {
+		t.Fatalf(`GET /characters/%s after a failed batch has ETag %s, want it unchanged`, hades.ID, rec.Header().Get("ETag"))
+	}
+
+	rec = do(router, "POST", "/characters:batch", `{"atomic": true, "operations": [
+		{"op": "create", "character": {"name": "Themis", "role": "Elidibus", "level": 99}},
+		{"op": "delete", "id": "`+venat.ID+`", "ifMatch": "\"1\""}
+	]}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK || body.Results[0].Status != 201 || body.Results[1].Status != 200 {
+		t.Fatalf(`POST /characters:batch = %d, %s, want 200 with every operation applied`, rec.Code, rec.Body)
+	}
+
+	if rec := do(router, "GET", "/characters/"+venat.ID, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf(`GET /characters/%s after the batch = %d, want 404`, venat.ID, rec.Code)
+	}
+}
+
+func TestBatchInvalid(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+
+	for _, body := range []string{`{"operations": []}`, `{"operations": [{"op": "delete", "id": "x"}], "bogus": 1}`, `[]`} {
+		if rec := do(router, "POST", "/characters:batch", body); rec.Code != http.StatusBadRequest {
+			t.Errorf(`POST /characters:batch with %s = %d, want 400`, body, rec.Code)
+		}
+	}
+
+	if rec := do(router, "POST", "/characters:unknown", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf(`POST /characters:unknown = %d, want 404`, rec.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etagOf returns the entity tag of a character, which changes along
+// with its version.
+func etagOf(char Character) string {
+	return strconv.Quote(strconv.Itoa(char.Version))
+}
+
+// matchETag reports whether etag is in the list of entity tags of an
+// If-Match or If-None-Match header, as per RFC 7232. The weak
+// comparison ignores the W/ prefix, while the strong one never
+// matches weak tags.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+
+			candidate = candidate[len("W/"):]
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatch returns the check of the If-Match header, to run on the
+// current state of the character inside the store. Without the
+// header, it returns nil, unless the server requires one: then it
+// responds with 428 Precondition Required itself and returns false.
+func (s *server) ifMatch(c *gin.Context) (CheckFunc, bool) {
+	check, err := s.precondition(c.GetHeader("If-Match"))
+	if err != nil {
+		respondWithError(c, err)
+		return nil, false
+	}
+
+	return check, true
+}
+
+// precondition returns the check of an If-Match header, or nil if
+// there's none. If the server requires one, a missing header gets a
+// *clientError for a 428 Precondition Required.
+func (s *server) precondition(header string) (CheckFunc, error) {
+	if header == "" {
+		if s.requireIfMatch {
+			return nil, &clientError{
+				status: http.StatusPreconditionRequired,
+				doc:    errorDocument{Message: "The If-Match header is required"},
+			}
+		}
+
+		return nil, nil
+	}
+
+	return func(current Character) error {
+		if matchETag(header, etagOf(current), false) {
+			return nil
+		}
+
+		return &clientError{
+			status: http.StatusPreconditionFailed,
+			doc:    errorDocument{Message: "The character has changed since it was read"},
+		}
+	}, nil
+}
+
+// notModified reports whether the client's copy of char, according to
+// If-None-Match, is up to date.
+func notModified(c *gin.Context, char Character) bool {
+	header := c.GetHeader("If-None-Match")
+	return header != "" && matchETag(header, etagOf(char), true)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// doWith sends a request with the given headers.
+func doWith(router http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header, etag string
+		weak, want   bool
+	}{
+		{`"1"`, `"1"`, false, true},
+		{`"2"`, `"1"`, false, false},
+		{`"2", "1"`, `"1"`, false, true},
+		{`*`, `"1"`, false, true},
+		{`W/"1"`, `"1"`, false, false},
+		{`W/"1"`, `"1"`, true, true},
+		{`1`, `"1"`, true, false},
+	}
+
+	for _, test := range tests {
+		if got := matchETag(test.header, test.etag, test.weak); got != test.want {
+			t.Errorf(`matchETag(%q, %q, %v) = %v, want %v`, test.header, test.etag, test.weak, got, test.want)
+		}
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	target := "/characters/" + seedCharacters[0].ID
+
+	rec := do(router, "GET", target, "")
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf(`GET %s returned ETag %q, want "1"`, target, etag)
+	}
+
+	rec = doWith(router, "GET", target, "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+		t.Fatalf(`GET %s with If-None-Match: %s = %d, %q, want 304 without a body`, target, etag, rec.Code, rec.Body)
+	}
+
+	rec = doWith(router, "GET", target, "", map[string]string{"If-None-Match": `"0"`})
+	if rec.Code != http.StatusOK {
+		t.Fatalf(`GET %s with a stale If-None-Match = %d, want 200`, target, rec.Code)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	target := "/characters/" + seedCharacters[0].ID
+	body := `{"name": "Hades", "role": "Emet-Selch", "level": 90}`
+
+	rec := doWith(router, "PUT", target, body, map[string]string{"If-Match": `"1"`})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf(`PUT %s with a fresh If-Match = %d, ETag %q, want 200, "2"`, target, rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// The other client still has version 1.
+	rec = doWith(router, "PUT", target, body, map[string]string{"If-Match": `"1"`})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf(`PUT %s with a stale If-Match = %d, want 412`, target, rec.Code)
+	}
+
+	rec = doWith(router, "PATCH", target, `{"level": 1}`, map[string]string{"If-Match": `"1"`, "Content-Type": mediaMergePatch})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf(`PATCH %s with a stale If-Match = %d, want 412`, target, rec.Code)
+	}
+
+	rec = doWith(router, "DELETE", target, "", map[string]string{"If-Match": `"1"`})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf(`DELETE %s with a stale If-Match = %d, want 412`, target, rec.Code)
+	}
+
+	rec = doWith(router, "DELETE", target, "", map[string]string{"If-Match": `"2"`})
+	if rec.Code != http.StatusOK {
+		t.Fatalf(`DELETE %s with a fresh If-Match = %d, want 200`, target, rec.Code)
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...), withRequireIfMatch())
+	target := "/characters/" + seedCharacters[0].ID
+
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		if rec := do(router, method, target, `{"name": "Hades", "level": 1}`); rec.Code != http.StatusPreconditionRequired {
+			t.Errorf(`%s %s without If-Match = %d, want 428`, method, target, rec.Code)
+		}
+	}
+
+	rec := doWith(router, "PUT", target, `{"name": "Hades", "level": 1}`, map[string]string{"If-Match": "*"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf(`PUT %s with If-Match: * = %d, want 200`, target, rec.Code)
+	}
+}
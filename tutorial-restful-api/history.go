@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRevisions is the number of revisions kept per character. Older
+// ones are dropped, so that the history doesn't grow forever.
+const maxRevisions = 100
+
+// ErrRevisionNotFound is returned when a character has no revision
+// with the given version, e.g. because it was dropped.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is a state a character was in, from the change that led
+// to it. Its version is the one of the character.
+type Revision struct {
+	Character Character `json:"character"`
+	// Author is who made the change, as given by withAuthor.
+	Author string    `json:"author"`
+	Time   time.Time `json:"time"`
+}
+
+// newRevision returns the revision for a change to char made now, by
+// the author of ctx.
+func newRevision(ctx context.Context, char Character) Revision {
+	// UTC drops the monotonic clock reading, so that revisions
+	// compare equal once read back.
+	return Revision{Character: char, Author: authorOf(ctx), Time: time.Now().UTC()}
+}
+
+type authorKey struct{}
+
+// withAuthor returns a context whose changes are recorded as made by
+// author.
+func withAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorKey{}, author)
+}
+
+// authorOf returns who the changes made with ctx are recorded as
+// made by, or "" if nobody is known. For requests, that's the account
+// or, without one, the client's address: see authenticate.
+func authorOf(ctx context.Context) string {
+	author, _ := ctx.Value(authorKey{}).(string)
+	return author
+}
+
+// listRevisions handles GET /characters/:id/revisions, oldest first.
+func (s *server) listRevisions(c *gin.Context) {
+	revisions, err := s.store.Revisions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// getRevision handles GET /characters/:id/revisions/:rev.
+func (s *server) getRevision(c *gin.Context) {
+	rev, err := s.revision(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, rev)
+}
+
+// restoreRevision handles POST /characters/:id/revisions/:rev/restore,
+// which puts the character back in the state of the revision. Like
+// any other change, it gets a new version, so that the history only
+// ever grows.
+func (s *server) restoreRevision(c *gin.Context) {
+	check, ok := s.checkWrite(c)
+	if !ok {
+		return
+	}
+
+	rev, err := s.revision(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	// The rules may have changed since.
+	if err := checkCharacter(rev.Character); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	char, err := s.store.Update(c.Request.Context(), c.Param("id"), guard(check, replaceWith(rev.Character)))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", etagOf(char))
+	c.IndentedJSON(http.StatusOK, char)
+}
+
+// revision returns the revision of the request's path.
+func (s *server) revision(c *gin.Context) (Revision, error) {
+	revisions, err := s.store.Revisions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return Revision{}, err
+	}
+
+	version, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		return Revision{}, ErrRevisionNotFound
+	}
+
+	for _, rev := range revisions {
+		if rev.Character.Version == version {
+			return rev, nil
+		}
+	}
+
+	return Revision{}, ErrRevisionNotFound
+}
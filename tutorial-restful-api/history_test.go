@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRevisionEndpoints(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	target := "/characters/" + seedCharacters[0].ID
+
+	do(router, "PUT", target, `{"name": "Hades", "role": "Emet-Selch", "level": 90}`)
+	do(router, "PUT", target, `{"name": "Haydes", "role": "Emet-Selch", "level": 90}`)
+
+	rec := do(router, "GET", target+"/revisions", "")
+	var list struct {
+		Revisions []Revision `json:"revisions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK || len(list.Revisions) != 3 {
+		t.Fatalf(`GET %s/revisions = %d, %s, want 3 revisions`, target, rec.Code, rec.Body)
+	}
+
+	if author := list.Revisions[2].Author; author != "192.0.2.1" {
+		t.Fatalf(`GET %s/revisions returned a revision by %q, want the client's address`, target, author)
+	}
+
+	rec = do(router, "GET", target+"/revisions/2", "")
+	var rev Revision
+	if err := json.Unmarshal(rec.Body.Bytes(), &rev); err != nil || rev.Character.Version != 2 || rev.Character.Level != 90 {
+		t.Fatalf(`GET %s/revisions/2 = %d, %s, want version 2`, target, rec.Code, rec.Body)
+	}
+
+	for _, rev := range []string{"0", "4", "latest"} {
+		if rec := do(router, "GET", target+"/revisions/"+rev, ""); rec.Code != http.StatusNotFound {
+			t.Errorf(`GET %s/revisions/%s = %d, want 404`, target, rev, rec.Code)
+		}
+	}
+
+	if rec := do(router, "GET", "/characters/unknown/revisions", ""); rec.Code != http.StatusNotFound {
+		t.Errorf(`GET /characters/unknown/revisions = %d, want 404`, rec.Code)
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	target := "/characters/" + seedCharacters[0].ID
+
+	do(router, "PUT", target, `{"name": "Haydes", "role": "Emet-Selch", "level": 1}`)
+
+	rec := doWith(router, "POST", target+"/revisions/1/restore", "", map[string]string{"If-Match": `"1"`})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf(`POST %s/revisions/1/restore with a stale If-Match = %d, want 412`, target, rec.Code)
+	}
+
+	rec = doWith(router, "POST", target+"/revisions/1/restore", "", map[string]string{"If-Match": `"2"`})
+	var char Character
+	if err := json.Unmarshal(rec.Body.Bytes(), &char); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf(`POST %s/revisions/1/restore = %d, %s, want 200`, target, rec.Code, rec.Body)
+	}
+
+	want := seedCharacters[0]
+	want.Version = 3
+	if char != want || rec.Header().Get("ETag") != `"3"` {
+		t.Fatalf(`POST %s/revisions/1/restore = %+v, ETag %s, want %+v as version 3`, target, char, rec.Header().Get("ETag"), want)
+	}
+
+	if rec := do(router, "POST", target+"/revisions/9/restore", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf(`POST %s/revisions/9/restore = %d, want 404`, target, rec.Code)
+	}
+}
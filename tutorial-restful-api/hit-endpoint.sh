@@ -5,6 +5,15 @@ action=$1
 # By default, this refers to Hades' uuid.
 uuid="${2:-4c0ba5d1-8139-4506-9334-08a8c3314c0d}"
 
+# Changes need credentials when the server checks them: set $API_KEY
+# to a key from -api-keys, or $TOKEN to one printed by -issue-token.
+auth=()
+if [ -n "$API_KEY" ]; then
+  auth=(--header "X-API-Key: $API_KEY")
+elif [ -n "$TOKEN" ]; then
+  auth=(--header "Authorization: Bearer $TOKEN")
+fi
+
 if [ $action = "" ]; then
   echo "Action not provided. Available ones: 'list', 'create', 'get"
   exit 1
@@ -15,24 +24,62 @@ case $action in
     curl localhost:8080/characters
     ;;
   "create")
-    curl http://localhost:8080/characters \
+    curl "${auth[@]}" http://localhost:8080/characters \
       --include \
       --header "Content-Type: application/json" \
       --request "POST" \
       --data '{"name": "Themis", "role": "Elidibus", "level": 99}'
     ;;
+  "batch")
+    curl "${auth[@]}" http://localhost:8080/characters:batch \
+      --include \
+      --header "Content-Type: application/json" \
+      --request "POST" \
+      --data '{"atomic": true, "operations": [
+        {"op": "create", "character": {"name": "Thancred", "role": "Scion", "level": 80}},
+        {"op": "create", "character": {"name": "Urianger", "role": "Scion", "level": 80}}
+      ]}'
+    ;;
   "get")
     curl localhost:8080/characters/$uuid
     ;;
   "update")
-    curl http://localhost:8080/characters/$uuid \
+    curl "${auth[@]}" http://localhost:8080/characters/$uuid \
+      --include \
+      --header "Content-Type: application/json" \
+      --request "PUT" \
+      --data '{"id": "4c0ba5d1-8139-4506-9334-08a8c3314c0d", "name": "Haydes", "role": "Emet-Selch", "level": 99}'
+    ;;
+  "patch")
+    curl "${auth[@]}" http://localhost:8080/characters/$uuid \
+      --include \
+      --header "Content-Type: application/merge-patch+json" \
+      --request "PATCH" \
+      --data '{"level": 90}'
+    ;;
+  "revisions")
+    curl localhost:8080/characters/$uuid/revisions
+    ;;
+  "restore")
+    # The third argument is the version to go back to.
+    curl "${auth[@]}" http://localhost:8080/characters/$uuid/revisions/${3:-1}/restore \
+      --include \
+      --request "POST"
+    ;;
+  "quotas")
+    curl "${auth[@]}" localhost:8080/quotas
+    ;;
+  "quota")
+    # The second argument is the account, and the third the number of
+    # characters it has remaining.
+    curl "${auth[@]}" http://localhost:8080/quotas/${2:-admin} \
       --include \
       --header "Content-Type: application/json" \
       --request "PUT" \
-      --data '{"id": "4c0ba5d1-8139-4506-9334-08a8c3314c0d", "name": "Haydes", "role": "Emet-Selch", "level": 99},'
+      --data "{\"remaining\": ${3:-10}}"
     ;;
   "delete")
-    curl http://localhost:8080/characters/$uuid \
+    curl "${auth[@]}" http://localhost:8080/characters/$uuid \
       --request "DELETE"
     ;;
 esac
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page sizes for GET /characters.
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+// listQuery is what GET /characters was asked for, e.g.
+// `?role=Scion&level[gte]=80&sort=-level,name&limit=10`.
+type listQuery struct {
+	// role has to match exactly, as in getCharactersByRole.
+	role string
+	// owner is the name of an account.
+	owner string
+	// namePrefix is matched by nameKey, as names are told apart.
+	namePrefix string
+	// The bounds are inclusive.
+	minLevel, maxLevel *int
+	sort               []sortKey
+	limit              int
+	offset             int
+}
+
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// listPage is the body of GET /characters.
+type listPage struct {
+	Characters []Character `json:"characters"`
+	// Total is the number of characters matching the filters, on
+	// every page.
+	Total int       `json:"total"`
+	Links listLinks `json:"links"`
+}
+
+type listLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// cursor is where a page starts. It's handed out base64-encoded, so
+// that clients don't rely on what's inside.
+type cursor struct {
+	Offset int `json:"offset"`
+	// Query is a hash of the filters and sort order, since the offset
+	// is meaningless with different ones.
+	Query uint64 `json:"query"`
+}
+
+// characterFields compares characters by each of the fields that can
+// be sorted on.
+var characterFields = map[string]func(a, b Character) int{
+	"id":    func(a, b Character) int { return strings.Compare(a.ID, b.ID) },
+	"owner": func(a, b Character) int { return strings.Compare(a.Owner, b.Owner) },
+	"name":  func(a, b Character) int { return strings.Compare(a.Name, b.Name) },
+	"role":  func(a, b Character) int { return strings.Compare(a.Role, b.Role) },
+	"level": func(a, b Character) int { return a.Level - b.Level },
+}
+
+// parseListQuery reads the query parameters of GET /characters.
+// Invalid ones get a *clientError for a 400 Bad Request.
+func parseListQuery(values url.Values) (listQuery, error) {
+	q := listQuery{limit: defaultLimit}
+	var errs []fieldError
+
+	for name, value := range values {
+		v := value[len(value)-1]
+		invalid := func(message string) {
+			errs = append(errs, fieldError{Field: name, Message: message})
+		}
+
+		switch name {
+		case "role":
+			q.role = v
+		case "owner":
+			q.owner = v
+		case "name[prefix]":
+			q.namePrefix = v
+		case "level", "level[gte]", "level[gt]", "level[lte]", "level[lt]":
+			level, err := strconv.Atoi(v)
+			if err != nil {
+				invalid("must be an integer")
+				continue
+			}
+
+			op := ""
+			if name != "level" {
+				op = name[len("level[") : len(name)-1]
+			}
+
+			q.boundLevel(op, level)
+		case "sort":
+			for _, field := range strings.Split(v, ",") {
+				key := sortKey{field: strings.TrimPrefix(field, "-"), desc: strings.HasPrefix(field, "-")}
+				if characterFields[key.field] == nil {
+					invalid(fmt.Sprintf("can't sort on %q", field))
+					continue
+				}
+
+				q.sort = append(q.sort, key)
+			}
+		case "limit":
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxLimit {
+				invalid(fmt.Sprintf("must be an integer between 1 and %d", maxLimit))
+				continue
+			}
+
+			q.limit = limit
+		case "cursor":
+			// Read below, once the query it's for is known.
+		default:
+			invalid("is not a known query parameter")
+		}
+	}
+
+	if v := values.Get("cursor"); v != "" && len(errs) == 0 {
+		var c cursor
+		content, err := base64.RawURLEncoding.DecodeString(v)
+		if err == nil {
+			err = json.Unmarshal(content, &c)
+		}
+
+		switch {
+		case err != nil || c.Offset < 0:
+			errs = append(errs, fieldError{Field: "cursor", Message: "is invalid"})
+		case c.Query != queryHash(values):
+			errs = append(errs, fieldError{Field: "cursor", Message: "belongs to a different query"})
+		default:
+			q.offset = c.Offset
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return listQuery{}, &clientError{
+			status: http.StatusBadRequest,
+			doc:    errorDocument{Message: "Invalid query parameters", Errors: errs},
+		}
+	}
+
+	return q, nil
+}
+
+// boundLevel narrows the level range with a comparison, e.g. "gte".
+// An empty op means equality.
+func (q *listQuery) boundLevel(op string, level int) {
+	lower := func(min int) {
+		if q.minLevel == nil || min > *q.minLevel {
+			q.minLevel = &min
+		}
+	}
+
+	upper := func(max int) {
+		if q.maxLevel == nil || max < *q.maxLevel {
+			q.maxLevel = &max
+		}
+	}
+
+	// No level is above the largest int, nor below the smallest, and
+	// no level is both.
+	none := func() {
+		lower(math.MaxInt)
+		upper(math.MinInt)
+	}
+
+	switch op {
+	case "":
+		lower(level)
+		upper(level)
+	case "gte":
+		lower(level)
+	case "gt":
+		if level == math.MaxInt {
+			none()
+			break
+		}
+
+		lower(level + 1)
+	case "lte":
+		upper(level)
+	case "lt":
+		if level == math.MinInt {
+			none()
+			break
+		}
+
+		upper(level - 1)
+	}
+}
+
+// apply filters and sorts the characters, which are in creation
+// order. Characters that compare equal stay in that order.
+func (q listQuery) apply(characters []Character) []Character {
+	matching := []Character{}
+	prefix := nameKey(q.namePrefix)
+
+	for _, char := range characters {
+		switch {
+		case q.role != "" && char.Role != q.role:
+		case q.owner != "" && char.Owner != q.owner:
+		case !strings.HasPrefix(nameKey(char.Name), prefix):
+		case q.minLevel != nil && char.Level < *q.minLevel:
+		case q.maxLevel != nil && char.Level > *q.maxLevel:
+		default:
+			matching = append(matching, char)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		for _, key := range q.sort {
+			cmp := characterFields[key.field](matching[i], matching[j])
+			if key.desc {
+				cmp = -cmp
+			}
+
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+
+		return false
+	})
+
+	return matching
+}
+
+// page cuts the page out of the matching characters, with links to
+// the pages around it.
+func (q listQuery) page(u *url.URL, matching []Character) listPage {
+	start := q.offset
+	if start > len(matching) {
+		start = len(matching)
+	}
+
+	end := start + q.limit
+	if end > len(matching) {
+		end = len(matching)
+	}
+
+	page := listPage{Characters: matching[start:end], Total: len(matching)}
+
+	if end < len(matching) {
+		page.Links.Next = pageLink(u, end)
+	}
+
+	if start > 0 {
+		prev := start - q.limit
+		if prev < 0 {
+			prev = 0
+		}
+
+		page.Links.Prev = pageLink(u, prev)
+	}
+
+	return page
+}
+
+// pageLink returns the URL of the page starting at offset, for the
+// same query as u.
+func pageLink(u *url.URL, offset int) string {
+	values := u.Query()
+	content, _ := json.Marshal(cursor{Offset: offset, Query: queryHash(values)})
+	values.Set("cursor", base64.RawURLEncoding.EncodeToString(content))
+
+	link := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return link.String()
+}
+
+// queryHash hashes the query parameters that decide which characters
+// are listed, and in which order.
+func queryHash(values url.Values) uint64 {
+	values = url.Values{
+		"role":         values["role"],
+		"owner":        values["owner"],
+		"name[prefix]": values["name[prefix]"],
+		"level":        values["level"],
+		"level[gte]":   values["level[gte]"],
+		"level[gt]":    values["level[gt]"],
+		"level[lte]":   values["level[lte]"],
+		"level[lt]":    values["level[lt]"],
+		"sort":         values["sort"],
+	}
+
+	h := fnv.New64a()
+	// Encode sorts the keys, and skips the empty ones.
+	h.Write([]byte(values.Encode()))
+	return h.Sum64()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// listCharactersStore holds the characters from create-tables.sql in
+// tutorial-relational-db.
+func listCharactersStore() *memoryStore {
+	return newMemoryStore(
+		Character{ID: "1", Name: "Hades", Role: "Emet-Selch", Level: 99},
+		Character{ID: "2", Name: "Venat", Role: "Former Azem", Level: 99},
+		Character{ID: "3", Name: "Hythlodaeus", Role: "Chief of the Bureau of the Architect", Level: 99},
+		Character{ID: "4", Name: "Thancred", Role: "Scion", Level: 80},
+		Character{ID: "5", Name: "Y'shtola", Role: "Scion", Level: 80},
+		Character{ID: "6", Name: "Urianger", Role: "Scion", Level: 80},
+		Character{ID: "7", Name: "Lyse", Role: "Ala Mhigan Resistance", Level: 70},
+	)
+}
+
+func getPage(t *testing.T, router http.Handler, target string) listPage {
+	t.Helper()
+
+	rec := do(router, "GET", target, "")
+	var page listPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf(`GET %s = %d, %s, want 200`, target, rec.Code, rec.Body)
+	}
+
+	return page
+}
+
+func names(characters []Character) string {
+	list := make([]string, len(characters))
+	for idx, char := range characters {
+		list[idx] = char.Name
+	}
+
+	return strings.Join(list, ",")
+}
+
+func TestListCharacters(t *testing.T) {
+	router := newRouter(listCharactersStore())
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "Hades,Venat,Hythlodaeus,Thancred,Y'shtola,Urianger,Lyse"},
+		{"role=Scion", "Thancred,Y'shtola,Urianger"},
+		{"role=scion", ""},
+		{"name[prefix]=h", "Hades,Hythlodaeus"},
+		{"level=80", "Thancred,Y'shtola,Urianger"},
+		{"level[gte]=80&level[lt]=99", "Thancred,Y'shtola,Urianger"},
+		{"level[gt]=70&level[lte]=80", "Thancred,Y'shtola,Urianger"},
+		{"level[lt]=80", "Lyse"},
+		// Rather than overflow.
+		{"level[gt]=" + strconv.Itoa(math.MaxInt), ""},
+		{"level[lt]=" + strconv.Itoa(math.MinInt), ""},
+		{"sort=name", "Hades,Hythlodaeus,Lyse,Thancred,Urianger,Venat,Y'shtola"},
+		{"sort=level,-name", "Lyse,Y'shtola,Urianger,Thancred,Venat,Hythlodaeus,Hades"},
+		// Ties keep the creation order.
+		{"sort=-level", "Hades,Venat,Hythlodaeus,Thancred,Y'shtola,Urianger,Lyse"},
+		{"role=Scion&sort=-name&limit=2", "Y'shtola,Urianger"},
+	}
+
+	for _, test := range tests {
+		page := getPage(t, router, "/characters?"+test.query)
+		if got := names(page.Characters); got != test.want {
+			t.Errorf(`GET /characters?%s = %s, want %s`, test.query, got, test.want)
+		}
+	}
+
+	// Prefixes are folded like names are, e.g. ß to ss.
+	router = newRouter(newMemoryStore(Character{ID: "1", Name: "Straße"}))
+	if got := names(getPage(t, router, "/characters?name[prefix]=STRASS").Characters); got != "Straße" {
+		t.Errorf(`GET /characters?name[prefix]=STRASS = %s, want Straße`, got)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	router := newRouter(listCharactersStore())
+
+	var got []string
+	target := "/characters?sort=name&limit=3"
+	var pages []listPage
+
+	for target != "" {
+		page := getPage(t, router, target)
+		if page.Total != 7 {
+			t.Fatalf(`GET %s returned a total of %d, want 7`, target, page.Total)
+		}
+
+		pages = append(pages, page)
+		got = append(got, names(page.Characters))
+		target = page.Links.Next
+	}
+
+	if want := "Hades,Hythlodaeus,Lyse|Thancred,Urianger,Venat|Y'shtola"; strings.Join(got, "|") != want {
+		t.Fatalf(`Paging through GET /characters returned %s, want %s`, strings.Join(got, "|"), want)
+	}
+
+	if pages[0].Links.Prev != "" {
+		t.Fatalf(`The first page links to a previous page: %s`, pages[0].Links.Prev)
+	}
+
+	if prev := getPage(t, router, pages[2].Links.Prev); names(prev.Characters) != "Thancred,Urianger,Venat" {
+		t.Fatalf(`The previous page of the last one is %s, want the second one`, names(prev.Characters))
+	}
+}
+
+func TestListInvalidQuery(t *testing.T) {
+	router := newRouter(listCharactersStore())
+
+	page := getPage(t, router, "/characters?sort=name&limit=3")
+	next, _ := url.Parse(page.Links.Next)
+	otherQuery := next.Query()
+	otherQuery.Set("sort", "-name")
+
+	for _, query := range []string{
+		"level[gte]=high",
+		"level[between]=1",
+		"sort=job",
+		"limit=0",
+		"limit=101",
+		"cursor=nope",
+		otherQuery.Encode(),
+	} {
+		rec := do(router, "GET", "/characters?"+query, "")
+
+		var doc errorDocument
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || rec.Code != http.StatusBadRequest || len(doc.Errors) != 1 {
+			t.Errorf(`GET /characters?%s = %d, %s, want 400 with a field error`, query, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength caps the X-Request-ID headers that are passed on.
+const maxRequestIDLength = 128
+
+// logger writes events as JSON lines, for log pipelines to parse. Each
+// line has the time, level and message of the event, along with its
+// fields and the ones given to With.
+type logger struct {
+	// mu is shared by the loggers made by With, so that their lines
+	// don't interleave.
+	mu  *sync.Mutex
+	out io.Writer
+	// fields are key-value pairs, as given to With.
+	fields []interface{}
+	now    func() time.Time
+}
+
+func newLogger(out io.Writer) *logger {
+	return &logger{mu: &sync.Mutex{}, out: out, now: time.Now}
+}
+
+// With returns a logger that adds the key-value pairs to every event.
+func (l *logger) With(keyvals ...interface{}) *logger {
+	child := *l
+	child.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &child
+}
+
+// Info logs an event with the key-value pairs as its fields.
+func (l *logger) Info(msg string, keyvals ...interface{}) {
+	l.log("info", msg, keyvals)
+}
+
+// Error logs an event that needs looking into.
+func (l *logger) Error(msg string, keyvals ...interface{}) {
+	l.log("error", msg, keyvals)
+}
+
+func (l *logger) log(level, msg string, keyvals []interface{}) {
+	event := map[string]interface{}{
+		"time":  l.now().UTC().Format(time.RFC3339Nano),
+		"level": level,
+		"msg":   msg,
+	}
+
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	for i := 0; i+1 < len(fields); i += 2 {
+		key, ok := fields[i].(string)
+		if !ok {
+			continue
+		}
+
+		// Errors marshal as {}, which says nothing.
+		if err, ok := fields[i+1].(error); ok {
+			event[key] = err.Error()
+			continue
+		}
+
+		event[key] = fields[i+1]
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{}{"level": "error", "msg": "Unloggable event", "error": err.Error()})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+// withRequestLogger makes the server log its requests, and what its
+// handlers log, with l instead of to gin.DefaultWriter.
+func withRequestLogger(l *logger) routerOption {
+	return func(s *server) {
+		s.logger = l
+	}
+}
+
+type loggerKey struct{}
+
+// withLogger returns a context whose events are logged with l.
+func withLogger(ctx context.Context, l *logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// defaultLogger is for the events that happen outside of requests.
+var defaultLogger = newLogger(os.Stderr)
+
+// loggerOf returns the logger of ctx. For requests, it adds their ID
+// to every event: see logRequests.
+func loggerOf(ctx context.Context) *logger {
+	if l, ok := ctx.Value(loggerKey{}).(*logger); ok {
+		return l
+	}
+
+	return defaultLogger
+}
+
+// logRequests gives each request an ID and a logger that adds it to
+// every event, then logs the request once it's handled. The ID comes
+// from the X-Request-ID header, so that it can be followed from
+// service to service, or is made up if there's none. Either way, it's
+// sent back in the response.
+func (s *server) logRequests(c *gin.Context) {
+	start := time.Now()
+
+	id := c.GetHeader("X-Request-ID")
+	if !validRequestID(id) {
+		id = uuid.New().String()
+	}
+
+	c.Header("X-Request-ID", id)
+	l := s.logger.With("request_id", id)
+	c.Request = c.Request.WithContext(withLogger(c.Request.Context(), l))
+
+	c.Next()
+
+	bytes := c.Writer.Size()
+	if bytes < 0 {
+		bytes = 0
+	}
+
+	fields := []interface{}{
+		"method", c.Request.Method,
+		// The template, e.g. /characters/:id, so that requests to the
+		// same endpoint can be grouped. It's empty for unknown routes.
+		"route", c.FullPath(),
+		"status", c.Writer.Status(),
+		"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+		"bytes", bytes,
+		"client_ip", c.ClientIP(),
+	}
+
+	// authenticate has replaced the request by then.
+	if account, ok := accountOf(c.Request.Context()); ok {
+		fields = append(fields, "account", account.Name)
+	}
+
+	if len(c.Errors) > 0 {
+		fields = append(fields, "errors", c.Errors.Errors())
+	}
+
+	if c.Writer.Status() >= 500 {
+		l.Error("Request", fields...)
+		return
+	}
+
+	l.Info("Request", fields...)
+}
+
+// validRequestID reports whether id is a request ID worth passing on:
+// short, and made of printable ASCII characters without spaces, so
+// that it can't mess with the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logLines decodes the JSON lines of out.
+func logLines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf(`Log line %q isn't JSON: %v`, line, err)
+		}
+
+		lines = append(lines, event)
+	}
+
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	router := newRouter(newMemoryStore(seedCharacters...), withAuthenticator(testTokens()), withRequestLogger(newLogger(&out)))
+	hades := "/characters/" + seedCharacters[0].ID
+
+	rec := doWith(router, "GET", hades, "", map[string]string{"X-Request-ID": "trace-42", "Authorization": bearer(t, "alisaie", false)["Authorization"]})
+	if rec.Header().Get("X-Request-ID") != "trace-42" {
+		t.Fatalf(`GET %s returned X-Request-ID %q, want the one of the request`, hades, rec.Header().Get("X-Request-ID"))
+	}
+
+	lines := logLines(t, &out)
+	want := map[string]interface{}{
+		"level":      "info",
+		"method":     "GET",
+		"route":      "/characters/:id",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(rec.Body.Len()),
+		"request_id": "trace-42",
+		"account":    "alisaie",
+	}
+	for key, value := range want {
+		if lines[0][key] != value {
+			t.Errorf(`Access log %q = %v, want %v`, key, lines[0][key], value)
+		}
+	}
+
+	if _, ok := lines[0]["latency_ms"].(float64); !ok {
+		t.Errorf(`Access log = %v, want a latency`, lines[0])
+	}
+
+	// IDs that could mess with the logs are replaced.
+	for _, id := range []string{"", "has spaces", strings.Repeat("x", maxRequestIDLength+1)} {
+		rec := doWith(router, "GET", hades, "", map[string]string{"X-Request-ID": id})
+		if got := rec.Header().Get("X-Request-ID"); got == id || !validRequestID(got) {
+			t.Errorf(`GET %s with X-Request-ID %q returned %q, want a new one`, hades, id, got)
+		}
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	var out bytes.Buffer
+	router := newRouter(newMemoryStore(), withRequestLogger(newLogger(&out)))
+	router.GET("/hello", func(c *gin.Context) {
+		loggerOf(c.Request.Context()).Info("Hello", "name", "Hades")
+	})
+
+	rec := doWith(router, "GET", "/hello", "", nil)
+
+	lines := logLines(t, &out)
+	if len(lines) != 2 || lines[0]["msg"] != "Hello" || lines[0]["name"] != "Hades" || lines[0]["request_id"] != rec.Header().Get("X-Request-ID") {
+		t.Fatalf(`Log = %v, want the event of the handler with the request ID, then the access log`, lines)
+	}
+}
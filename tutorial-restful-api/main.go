@@ -1,113 +1,436 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/go-sql-driver/mysql"
 )
 
 type Character struct {
 	// Apparently `gin` requires us to set the
 	// "field" names with PascalCase.
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Role  string `json:"role"`
-	Level int    `json:"level"`
+	ID string `json:"id"`
+	// Version starts at 1 and goes up with every change. The stores
+	// take care of it, so it's ignored in requests.
+	Version int `json:"version"`
+	// Owner is the name of the account the character belongs to. It's
+	// set when the character is created, and kept afterwards.
+	Owner string `json:"owner" binding:"max=128"`
+	// The limits match the columns in tutorial-relational-db.
+	Name  string `json:"name" binding:"required,max=128"`
+	Role  string `json:"role" binding:"max=255"`
+	Level int    `json:"level" binding:"min=1,max=99"`
 }
 
 func main() {
-	router := gin.Default()
-	router.GET("/characters", listCharacters)
-	router.POST("/characters", postCharacters)
-	router.GET("/characters/:id", getCharacter)
+	storeKind := flag.String("store", "memory", "where to keep the characters: `memory`, file or sql")
+	data := flag.String("data", "characters.jsonl", "the log file used by -store=file")
+	dsn := flag.String("dsn", "", "the MySQL data source name used by -store=sql (defaults to the $MYSQL_USERNAME and $MYSQL_PASSWORD of tutorial-relational-db; needs parseTime=true)")
+	account := flag.String("account", "admin", "the account whose characters_remaining is used by -store=sql")
+	requireIfMatch := flag.Bool("require-if-match", false, "reject PUT, PATCH and DELETE requests without an If-Match header")
+	apiKeysPath := flag.String("api-keys", "", "a JSON `file` of API keys, e.g. {\"<key>\": {\"account\": \"admin\", \"admin\": true}}")
+	issueToken := flag.String("issue-token", "", "print a bearer token for the `account`, signed with $TOKEN_SECRET, and exit")
+	issueAdmin := flag.Bool("issue-admin", false, "make the token printed by -issue-token an admin one")
+	rateLimit := flag.Int("rate-limit", 600, "the requests per minute each client can make, or 0 for no limit")
+	createRateLimit := flag.Int("create-rate-limit", 60, "the characters per minute each client can create, with POST /characters or in batches, or 0 for no limit")
+	trustedProxies := flag.String("trusted-proxies", "", "the comma-separated `addresses` of the proxies whose X-Forwarded-For headers are trusted to give the client's IP address")
+	flag.Parse()
 
-	// These endpoints aren't in the tutorial, but
-	// let's create it nonetheless.
-	router.PUT("/characters/:id", updateCharacter)
-	router.DELETE("/characters/:id", deleteCharacter)
+	var authenticators []Authenticator
+	if secret := os.Getenv("TOKEN_SECRET"); secret != "" {
+		authenticators = append(authenticators, newTokens([]byte(secret)))
+	}
+
+	if *issueToken != "" {
+		if len(authenticators) == 0 {
+			log.Fatal("-issue-token needs $TOKEN_SECRET")
+		}
+
+		token, err := authenticators[0].(*tokens).sign(tokenClaims{
+			Subject:   *issueToken,
+			Admin:     *issueAdmin,
+			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(token)
+		return
+	}
+
+	if *apiKeysPath != "" {
+		keys, err := loadAPIKeys(*apiKeysPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		authenticators = append(authenticators, keys)
+	}
+
+	var store CharacterStore
+	switch *storeKind {
+	case "memory":
+		store = newMemoryStore(seedCharacters...)
+	case "file":
+		fileStore, err := openFileStore(*data, seedCharacters...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fileStore.Close()
+
+		store = fileStore
+	case "sql":
+		db, err := openMySQL(*dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		store = newSQLStore(db, dialectMySQL, *account)
+	default:
+		log.Fatalf("unknown store %q", *storeKind)
+	}
+
+	logger := newLogger(os.Stdout)
+	opts := []routerOption{withRequestLogger(logger)}
+	if *requireIfMatch {
+		opts = append(opts, withRequireIfMatch())
+	}
+
+	if len(authenticators) > 0 {
+		opts = append(opts, withAuthenticator(authenticators...))
+	} else {
+		logger.Info("Neither $TOKEN_SECRET nor -api-keys is set: anyone can change any character")
+	}
+
+	opts = append(opts, withRateLimits(newMemoryRateLimiter(), rateLimits{
+		Default: RateLimit{Requests: *rateLimit, Per: time.Minute},
+		Routes: map[string]RateLimit{
+			createRoute: {Requests: *createRateLimit, Per: time.Minute},
+		},
+	}))
+
+	router := newRouter(store, opts...)
+	if *trustedProxies != "" {
+		if err := router.SetTrustedProxies(strings.Split(*trustedProxies, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	router.Run("localhost:8080")
 }
 
-var characters = []Character{
-	{ID: "4c0ba5d1-8139-4506-9334-08a8c3314c0d", Name: "Hades", Role: "Emet-Selch", Level: 99},
-	{ID: "73d8e5e4-7a81-433f-ae87-66143e5e07b7", Name: "Venat", Role: "Former Azem", Level: 99},
-	{ID: "514e0e54-9712-4207-86ba-b45d3ac1b074", Name: "Hythlodaeus", Role: "Chief of the Bureau of the Architect", Level: 99},
+// openMySQL connects to the database set up by tutorial-relational-db.
+func openMySQL(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		cfg := mysql.Config{
+			User:                 os.Getenv("MYSQL_USERNAME"),
+			Passwd:               os.Getenv("MYSQL_PASSWORD"),
+			Net:                  "tcp",
+			Addr:                 "127.0.0.1:3306",
+			DBName:               "characters",
+			AllowNativePasswords: true,
+			// For the times of the revisions.
+			ParseTime: true,
+		}
+		dsn = cfg.FormatDSN()
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+var seedCharacters = []Character{
+	{ID: "4c0ba5d1-8139-4506-9334-08a8c3314c0d", Name: "Hades", Role: "Emet-Selch", Level: 99, Version: 1, Owner: "admin"},
+	{ID: "73d8e5e4-7a81-433f-ae87-66143e5e07b7", Name: "Venat", Role: "Former Azem", Level: 99, Version: 1, Owner: "admin"},
+	{ID: "514e0e54-9712-4207-86ba-b45d3ac1b074", Name: "Hythlodaeus", Role: "Chief of the Bureau of the Architect", Level: 99, Version: 1, Owner: "admin"},
 }
 
-func listCharacters(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, gin.H{"characters": characters})
+// server holds what the handlers need. The handlers only ever talk
+// to the store, so they don't need any locking of their own.
+type server struct {
+	store CharacterStore
+	// requireIfMatch makes PUT, PATCH and DELETE fail without an
+	// If-Match header, so that clients can't overwrite changes they
+	// haven't seen.
+	requireIfMatch bool
+	// authenticators check the credentials of the requests. See
+	// withAuthenticator.
+	authenticators []Authenticator
+	// limiter counts the requests of each client, if they're limited.
+	// See withRateLimits.
+	limiter    RateLimiter
+	rateLimits rateLimits
+	// logger logs the requests. See logRequests.
+	logger *logger
 }
 
-func postCharacters(c *gin.Context) {
+// routerOption configures the server behind a router.
+type routerOption func(*server)
+
+// withRequireIfMatch makes the If-Match header mandatory on PUT,
+// PATCH and DELETE.
+func withRequireIfMatch() routerOption {
+	return func(s *server) {
+		s.requireIfMatch = true
+	}
+}
+
+// newRouter returns the router serving the character endpoints
+// from the given store.
+func newRouter(store CharacterStore, opts ...routerOption) *gin.Engine {
+	s := &server{store: store, logger: newLogger(gin.DefaultWriter)}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// Index the stores that can't search themselves. If that fails,
+	// searches get a 501 Not Implemented, but the rest still works.
+	if _, ok := store.(Searcher); !ok {
+		indexed, err := newIndexedStore(context.Background(), store)
+		if err != nil {
+			s.logger.Error("Search isn't available", "error", err)
+		} else {
+			s.store = indexed
+		}
+	}
+
+	// Unlike gin.Default, log the requests as JSON. Recovery comes
+	// after, so that requests that panic are logged as 500s.
+	router := gin.New()
+	// Don't trust X-Forwarded-For headers, which anyone can send, to
+	// tell clients apart, unless main is told where proxies are.
+	router.SetTrustedProxies(nil)
+	router.Use(s.logRequests, gin.Recovery())
+	router.Use(s.authenticate)
+	if s.limiter != nil {
+		router.Use(s.limitRate)
+	}
+
+	router.GET("/characters", s.listCharacters)
+	router.POST("/characters", s.requireAccount, s.postCharacters)
+	router.POST("/characters:action", s.requireAccount, s.characterAction)
+	router.GET("/characters/search", s.searchCharacters)
+	router.GET("/characters/:id", s.getCharacter)
+
+	// These endpoints aren't in the tutorial, but
+	// let's create it nonetheless.
+	router.PUT("/characters/:id", s.requireAccount, s.updateCharacter)
+	router.PATCH("/characters/:id", s.requireAccount, s.patchCharacter)
+	router.DELETE("/characters/:id", s.requireAccount, s.deleteCharacter)
+
+	router.GET("/characters/:id/revisions", s.listRevisions)
+	router.GET("/characters/:id/revisions/:rev", s.getRevision)
+	router.POST("/characters/:id/revisions/:rev/restore", s.requireAccount, s.restoreRevision)
+
+	router.GET("/quotas", s.requireAdmin, s.listQuotas)
+	router.GET("/quotas/:account", s.requireAccount, s.getQuota)
+	router.PUT("/quotas/:account", s.requireAdmin, s.putQuota)
+	router.POST("/quotas/:account/adjust", s.requireAdmin, s.adjustQuota)
+	router.DELETE("/quotas/:account", s.requireAdmin, s.deleteQuota)
+
+	return router
+}
+
+// listCharacters returns a page of characters, filtered and sorted
+// as the query parameters say. See listQuery.
+func (s *server) listCharacters(c *gin.Context) {
+	query, err := parseListQuery(c.Request.URL.Query())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	characters, err := s.store.List(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, query.page(c.Request.URL, query.apply(characters)))
+}
+
+func (s *server) postCharacters(c *gin.Context) {
 	var newCharacter Character
 
-	if err := c.BindJSON(&newCharacter); err != nil {
+	if !bindCharacter(c, &newCharacter) {
 		return
 	}
 
-	newCharacter.ID = uuid.New().String()
-	characters = append(characters, newCharacter)
+	newCharacter.Owner = ownerFor(c.Request.Context(), newCharacter.Owner)
+	newCharacter, err := s.store.Create(c.Request.Context(), newCharacter)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
 
+	c.Header("ETag", etagOf(newCharacter))
 	c.IndentedJSON(http.StatusCreated, newCharacter)
 }
 
-func getCharacter(c *gin.Context) {
-	id := c.Param("id")
+func (s *server) getCharacter(c *gin.Context) {
+	char, err := s.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
 
-	for _, char := range characters {
-		if char.ID == id {
-			c.IndentedJSON(http.StatusOK, char)
-			return
-		}
+	c.Header("ETag", etagOf(char))
+	if notModified(c, char) {
+		c.Status(http.StatusNotModified)
+		return
 	}
 
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Character not found"})
+	c.IndentedJSON(http.StatusOK, char)
 }
 
-func updateCharacter(c *gin.Context) {
+func (s *server) updateCharacter(c *gin.Context) {
+	check, ok := s.checkWrite(c)
+	if !ok {
+		return
+	}
+
 	var body Character
 
-	c.ShouldBindJSON(&body)
-	id := c.Param("id")
-
-	for idx, char := range characters {
-		if char.ID == id {
-			// Unsure if there's a good way to do it,
-			// but I just simply changed the array directly.
-			// After that, I manually updated the `ID`.
-			// This is so that, in case the JSON body contains
-			// invalid `id`, then the valid id will still be used.
-			// It's overengineering, I agree, for this case...
-			characters[idx] = body
-			// Ensure that ID isn't replaced.
-			characters[idx].ID = id
-
-			c.IndentedJSON(http.StatusOK, characters[idx])
-			return
-		}
+	if !bindCharacter(c, &body) {
+		return
+	}
+
+	// The store makes sure that the ID in the path is kept,
+	// even if the JSON body contains an invalid `id`.
+	char, err := s.store.Update(c.Request.Context(), c.Param("id"), guard(check, replaceWith(body)))
+	if err != nil {
+		respondWithError(c, err)
+		return
 	}
 
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Character not found"})
+	c.Header("ETag", etagOf(char))
+	c.IndentedJSON(http.StatusOK, char)
 }
 
-func deleteCharacter(c *gin.Context) {
-	id := c.Param("id")
-	var characterIdx int = -1
+// patchCharacter changes some fields of a character, with either a
+// JSON Merge Patch or a JSON Patch depending on the Content-Type.
+// The patch is applied and the result validated inside the store's
+// update, so that concurrent changes can't slip in between.
+func (s *server) patchCharacter(c *gin.Context) {
+	c.Header("Accept-Patch", mediaMergePatch+", "+mediaJSONPatch)
 
-	for idx, char := range characters {
-		if char.ID == id {
-			characterIdx = idx
-			break
-		}
+	check, ok := s.checkWrite(c)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, decodeError(err))
+		return
+	}
+
+	media, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	patch, err := parsePatch(media, body)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	char, err := s.store.Update(c.Request.Context(), c.Param("id"), guard(check, func(current Character) (Character, error) {
+		return patchCharacter(current, patch)
+	}))
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", etagOf(char))
+	c.IndentedJSON(http.StatusOK, char)
+}
+
+func (s *server) deleteCharacter(c *gin.Context) {
+	check, ok := s.checkWrite(c)
+	if !ok {
+		return
 	}
 
-	if characterIdx == -1 {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Character not found"})
+	if err := s.store.Delete(c.Request.Context(), c.Param("id"), check); err != nil {
+		respondWithError(c, err)
 		return
 	}
 
-	characters = append(characters[:characterIdx], characters[characterIdx+1:]...)
 	c.IndentedJSON(http.StatusOK, gin.H{})
 }
+
+// respondWithError turns an error from the store into a response.
+func respondWithError(c *gin.Context, err error) {
+	status, doc := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		c.Error(err)
+	}
+
+	if doc.Location != "" {
+		c.Header("Location", doc.Location)
+	}
+
+	c.IndentedJSON(status, doc)
+}
+
+// errorResponse returns the status and body of the response to an
+// error from the store.
+func errorResponse(err error) (int, errorDocument) {
+	var clientErr *clientError
+	if errors.As(err, &clientErr) {
+		return clientErr.status, clientErr.doc
+	}
+
+	if errors.Is(err, ErrCharacterNotFound) {
+		return http.StatusNotFound, errorDocument{Message: "Character not found"}
+	}
+
+	if errors.Is(err, ErrRevisionNotFound) {
+		return http.StatusNotFound, errorDocument{Message: "Revision not found"}
+	}
+
+	var nameErr *NameTakenError
+	if errors.As(err, &nameErr) {
+		return http.StatusConflict, errorDocument{
+			Message:  "Another character has this name",
+			Errors:   []fieldError{{Field: "name", Message: "is taken"}},
+			Location: "/characters/" + nameErr.ID,
+		}
+	}
+
+	if errors.Is(err, ErrNoCharactersRemaining) {
+		return http.StatusForbidden, errorDocument{Message: "No characters remaining"}
+	}
+
+	if errors.Is(err, ErrQuotaNotFound) {
+		return http.StatusNotFound, errorDocument{Message: "Quota not found"}
+	}
+
+	if errors.Is(err, ErrQuotaTooLow) {
+		return http.StatusConflict, errorDocument{Message: "The quota can't go below zero"}
+	}
+
+	return http.StatusInternalServerError, errorDocument{Message: "Internal server error"}
+}
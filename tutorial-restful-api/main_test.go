@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+}
+
+// do sends a request to the router and returns the response.
+func do(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCharacterEndpoints(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+
+	rec := do(router, "POST", "/characters", `{"name": "Themis", "role": "Elidibus", "level": 99}`)
+	var created Character
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated || created.ID == "" {
+		t.Fatalf(`POST /characters = %d, %s, want 201 and a character`, rec.Code, rec.Body)
+	}
+
+	if rec := do(router, "GET", "/characters/"+created.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf(`GET /characters/%s = %d, want 200`, created.ID, rec.Code)
+	}
+
+	rec = do(router, "PUT", "/characters/"+created.ID, `{"id": "bogus", "name": "Themis", "role": "Elidibus", "level": 90}`)
+	var updated Character
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil || updated.ID != created.ID || updated.Level != 90 {
+		t.Fatalf(`PUT /characters/%s = %d, %s, want the level changed`, created.ID, rec.Code, rec.Body)
+	}
+
+	if rec := do(router, "DELETE", "/characters/"+created.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf(`DELETE /characters/%s = %d, want 200`, created.ID, rec.Code)
+	}
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		if rec := do(router, method, "/characters/"+created.ID, `{"name": "Themis", "level": 1}`); rec.Code != http.StatusNotFound {
+			t.Errorf(`%s /characters/%s after DELETE = %d, want 404`, method, created.ID, rec.Code)
+		}
+	}
+}
+
+// TestConcurrentRequests sends writes from many goroutines at once,
+// which used to race on the package-level slice. Run it with -race.
+func TestConcurrentRequests(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	const requests = 50
+
+	var wg sync.WaitGroup
+	wg.Add(requests)
+
+	for i := 0; i < requests; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			body := fmt.Sprintf(`{"name": "Scion %d", "role": "Scion", "level": 80}`, i)
+			rec := do(router, "POST", "/characters", body)
+			if rec.Code != http.StatusCreated {
+				t.Errorf(`POST /characters = %d`, rec.Code)
+				return
+			}
+
+			var char Character
+			json.Unmarshal(rec.Body.Bytes(), &char)
+
+			do(router, "PUT", "/characters/"+char.ID, `{"name": "Scion", "role": "Scion", "level": 90}`)
+			do(router, "GET", "/characters", "")
+			do(router, "DELETE", "/characters/"+char.ID, "")
+		}(i)
+	}
+
+	wg.Wait()
+
+	var body struct {
+		Characters []Character `json:"characters"`
+	}
+	rec := do(router, "GET", "/characters", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body.Characters) != len(seedCharacters) {
+		t.Fatalf(`GET /characters returned %d characters, %v, want %d`, len(body.Characters), err, len(seedCharacters))
+	}
+}
+
+func TestDuplicateName(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	hades := "/characters/" + seedCharacters[0].ID
+
+	rec := do(router, "POST", "/characters", `{"name": "HADES", "role": "Emet-Selch", "level": 90}`)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Location") != hades || !strings.Contains(rec.Body.String(), `"location": "`+hades+`"`) {
+		t.Fatalf(`POST /characters with a taken name = %d, %v, %s, want 409 pointing to %s`, rec.Code, rec.Header(), rec.Body, hades)
+	}
+
+	venat := "/characters/" + seedCharacters[1].ID
+	if rec := do(router, "PUT", venat, `{"name": "hades", "role": "Former Azem", "level": 99}`); rec.Code != http.StatusConflict || rec.Header().Get("Location") != hades {
+		t.Fatalf(`PUT %s with a taken name = %d, %v, want 409 pointing to %s`, venat, rec.Code, rec.Header(), hades)
+	}
+
+	rec = do(router, "POST", "/characters:batch", `{"operations": [{"op": "create", "character": {"name": "Hades", "level": 90}}]}`)
+	var batch batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil || batch.Results[0].Status != http.StatusConflict || batch.Results[0].Error.Location != hades {
+		t.Fatalf(`POST /characters:batch with a taken name = %s, want a 409 result pointing to %s`, rec.Body, hades)
+	}
+}
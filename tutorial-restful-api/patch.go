@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The media types accepted by PATCH /characters/:id.
+const (
+	// RFC 7396: the body looks like the character, with only the
+	// fields to change. null removes a field, i.e. resets it.
+	mediaMergePatch = "application/merge-patch+json"
+	// RFC 6902: the body is a list of operations.
+	mediaJSONPatch = "application/json-patch+json"
+)
+
+// patchOperation is a single operation of a JSON Patch.
+type patchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from"`
+	// Value is nil when missing, and `null` when set to null.
+	Value json.RawMessage `json:"value"`
+}
+
+// patchFunc applies a patch to a character, as a JSON document.
+type patchFunc func(doc interface{}) (interface{}, error)
+
+// parsePatch reads a patch in the given media type, so that it can be
+// applied later on. Patches that can't be parsed get a *clientError
+// for a 400 Bad Request, and unknown media types one for a 415
+// Unsupported Media Type.
+func parsePatch(media string, body []byte) (patchFunc, error) {
+	switch media {
+	case mediaMergePatch:
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, badPatch("Malformed merge patch: %v", err)
+		}
+
+		// Only an object can turn a character into a character.
+		if _, ok := patch.(map[string]interface{}); !ok {
+			return nil, badPatch("A merge patch must be a JSON object")
+		}
+
+		return func(doc interface{}) (interface{}, error) {
+			return mergePatch(doc, patch), nil
+		}, nil
+	case mediaJSONPatch:
+		var ops []patchOperation
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&ops); err != nil {
+			return nil, badPatch("Malformed JSON patch: %v", err)
+		}
+
+		for idx, op := range ops {
+			if err := op.check(); err != nil {
+				return nil, badPatch("Operation %d: %v", idx, err)
+			}
+		}
+
+		return func(doc interface{}) (interface{}, error) {
+			return applyJSONPatch(doc, ops)
+		}, nil
+	default:
+		return nil, &clientError{
+			status: http.StatusUnsupportedMediaType,
+			doc:    errorDocument{Message: fmt.Sprintf("PATCH bodies must be %s or %s", mediaMergePatch, mediaJSONPatch)},
+		}
+	}
+}
+
+// patchCharacter applies the patch to char. If the patch doesn't
+// apply, e.g. a "test" operation fails, the error is a *clientError
+// for a 409 Conflict. If the result isn't a valid character, it's one
+// for a 422 Unprocessable Entity.
+func patchCharacter(char Character, patch patchFunc) (Character, error) {
+	doc, err := toDocument(char)
+	if err != nil {
+		return Character{}, err
+	}
+
+	doc, err = patch(doc)
+	if err != nil {
+		return Character{}, &clientError{status: http.StatusConflict, doc: errorDocument{Message: err.Error()}}
+	}
+
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return Character{}, err
+	}
+
+	var patched Character
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&patched); err != nil {
+		doc := decodeError(err)
+		doc.Message = "The patched character is invalid"
+		return Character{}, &clientError{status: http.StatusUnprocessableEntity, doc: doc}
+	}
+
+	if err := checkCharacter(patched); err != nil {
+		return Character{}, err
+	}
+
+	return patched, nil
+}
+
+// toDocument turns char into the generic JSON document that patches
+// work on.
+func toDocument(char Character) (interface{}, error) {
+	content, err := json.Marshal(char)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(content, &doc)
+	return doc, err
+}
+
+// mergePatch applies an RFC 7396 merge patch to target.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+
+	return targetObj
+}
+
+// check makes sure the operation has what it needs.
+func (op patchOperation) check() error {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%q needs a value", op.Op)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return err
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+
+	_, err := parsePointer(op.Path)
+	return err
+}
+
+// applyJSONPatch applies the operations of an RFC 6902 JSON Patch to
+// doc, one after the other. doc may be modified even if an operation
+// fails.
+func applyJSONPatch(doc interface{}, ops []patchOperation) (interface{}, error) {
+	for idx, op := range ops {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("Operation %d (%s %s): %v", idx, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+	// The pointers were checked by parsePatch.
+	path, _ := parsePointer(op.Path)
+
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	case "remove":
+		doc, _, err := removeValue(doc, path)
+		return doc, err
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+
+		if doc, _, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	case "move":
+		from, _ := parsePointer(op.From)
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, errors.New("can't move a value into itself")
+		}
+
+		doc, value, err := removeValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	case "copy":
+		from, _ := parsePointer(op.From)
+		value, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		// Copy the value, so that later operations on either one
+		// don't affect the other.
+		if value, err = deepCopy(value); err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	default: // "test"
+		want, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+
+		got, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			return nil, errors.New("test failed")
+		}
+
+		return doc, nil
+	}
+}
+
+func (op patchOperation) value() (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(op.Value, &value)
+	return value, err
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into reference tokens.
+// The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		tokens[idx] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+
+			doc = value
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			doc = node[idx]
+		default:
+			return nil, fmt.Errorf("can't look up %q in a scalar", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// updateParent calls update on the container holding the value at
+// path, with the last token of the path, and stores the container it
+// returns in place of the old one.
+func updateParent(doc interface{}, path []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	if child, err = updateParent(child, path[1:], update); err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		// getValue made sure that the index is valid.
+		idx, _ := strconv.Atoi(path[0])
+		node[idx] = child
+	}
+
+	return doc, nil
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+
+			idx, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("can't add %q to a scalar", token)
+		}
+	})
+}
+
+// removeValue removes the value at path, returning it along with the
+// updated document.
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed interface{}
+	doc, err := updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			removed = node[idx]
+			return append(node[:idx], node[idx+1:]...), nil
+		default:
+			return nil, fmt.Errorf("can't remove %q from a scalar", token)
+		}
+	})
+
+	return doc, removed, err
+}
+
+// arrayIndex parses an array index that can't be larger than max.
+func arrayIndex(token string, max int) (int, error) {
+	// Leading zeros aren't allowed, and neither are signs.
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx > max {
+		return 0, fmt.Errorf("array index %q out of bounds", token)
+	}
+
+	return idx, nil
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied interface{}
+	err = json.Unmarshal(content, &copied)
+	return copied, err
+}
+
+func badPatch(format string, args ...interface{}) error {
+	return &clientError{status: http.StatusBadRequest, doc: errorDocument{Message: fmt.Sprintf(format, args...)}}
+}
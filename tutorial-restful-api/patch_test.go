@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// doPatch sends a PATCH request with the given content type.
+func doPatch(router http.Handler, target, media, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", target, strings.NewReader(body))
+	req.Header.Set("Content-Type", media)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPatchCharacter(t *testing.T) {
+	hades := seedCharacters[0]
+
+	tests := []struct {
+		media  string
+		body   string
+		status int
+		want   Character
+	}{
+		{mediaMergePatch, `{"level": 80}`, http.StatusOK, Character{hades.ID, 2, hades.Owner, "Hades", "Emet-Selch", 80}},
+		{mediaMergePatch, `{"role": null, "id": "bogus"}`, http.StatusOK, Character{hades.ID, 2, hades.Owner, "Hades", "", 99}},
+		{mediaMergePatch + "; charset=utf-8", `{}`, http.StatusOK, Character{hades.ID, 2, hades.Owner, "Hades", "Emet-Selch", 99}},
+		{mediaJSONPatch, `[{"op": "replace", "path": "/name", "value": "Emet-Selch"}, {"op": "copy", "from": "/name", "path": "/role"}]`, http.StatusOK, Character{hades.ID, 2, hades.Owner, "Emet-Selch", "Emet-Selch", 99}},
+		{mediaJSONPatch, `[{"op": "test", "path": "/level", "value": 99}, {"op": "replace", "path": "/level", "value": 1}]`, http.StatusOK, Character{hades.ID, 2, hades.Owner, "Hades", "Emet-Selch", 1}},
+		{mediaJSONPatch, `[]`, http.StatusOK, Character{hades.ID, 2, hades.Owner, "Hades", "Emet-Selch", 99}},
+
+		// The patch doesn't apply.
+		{mediaJSONPatch, `[{"op": "test", "path": "/level", "value": 98}, {"op": "replace", "path": "/level", "value": 1}]`, http.StatusConflict, hades},
+		{mediaJSONPatch, `[{"op": "replace", "path": "/job", "value": "Paladin"}]`, http.StatusConflict, hades},
+
+		// The result isn't a valid character.
+		{mediaMergePatch, `{"name": null}`, http.StatusUnprocessableEntity, hades},
+		{mediaMergePatch, `{"level": 100}`, http.StatusUnprocessableEntity, hades},
+		{mediaMergePatch, `{"job": "Paladin"}`, http.StatusUnprocessableEntity, hades},
+		{mediaJSONPatch, `[{"op": "add", "path": "/level", "value": "99"}]`, http.StatusUnprocessableEntity, hades},
+		{mediaJSONPatch, `[{"op": "remove", "path": ""}]`, http.StatusUnprocessableEntity, hades},
+
+		// The patch itself is broken.
+		{mediaMergePatch, `{"level": 80`, http.StatusBadRequest, hades},
+		{mediaMergePatch, `[80]`, http.StatusBadRequest, hades},
+		{mediaJSONPatch, `{"level": 80}`, http.StatusBadRequest, hades},
+		{mediaJSONPatch, `[{"op": "increment", "path": "/level"}]`, http.StatusBadRequest, hades},
+		{mediaJSONPatch, `[{"op": "add", "path": "/level"}]`, http.StatusBadRequest, hades},
+		{mediaJSONPatch, `[{"op": "add", "path": "level", "value": 1}]`, http.StatusBadRequest, hades},
+		{"application/json", `{"level": 80}`, http.StatusUnsupportedMediaType, hades},
+	}
+
+	for _, test := range tests {
+		router := newRouter(newMemoryStore(seedCharacters...))
+
+		rec := doPatch(router, "/characters/"+hades.ID, test.media, test.body)
+		if rec.Code != test.status {
+			t.Errorf(`PATCH (%s) %s = %d, %s, want %d`, test.media, test.body, rec.Code, rec.Body, test.status)
+			continue
+		}
+
+		var got Character
+		rec = do(router, "GET", "/characters/"+hades.ID, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got != test.want {
+			t.Errorf(`After PATCH (%s) %s, GET = %s, want %+v`, test.media, test.body, rec.Body, test.want)
+		}
+	}
+}
+
+func TestPatchMissingCharacter(t *testing.T) {
+	router := newRouter(newMemoryStore())
+
+	if rec := doPatch(router, "/characters/nobody", mediaMergePatch, `{"level": 1}`); rec.Code != http.StatusNotFound {
+		t.Fatalf(`PATCH /characters/nobody = %d, want 404`, rec.Code)
+	}
+}
+
+// TestApplyJSONPatch covers the parts of RFC 6902 that characters
+// don't exercise, using examples from its appendix.
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"foo": ["bar", "baz"]}`, `[{"op": "add", "path": "/foo/1", "value": "qux"}]`, `{"foo": ["bar", "qux", "baz"]}`},
+		{`{"foo": ["bar"]}`, `[{"op": "add", "path": "/foo/-", "value": ["abc"]}]`, `{"foo": ["bar", ["abc"]]}`},
+		{`{"foo": ["bar", "qux", "baz"]}`, `[{"op": "remove", "path": "/foo/1"}]`, `{"foo": ["bar", "baz"]}`},
+		{`{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`, `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`, `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`},
+		{`{"foo": ["all", "grass", "cows", "eat"]}`, `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`, `{"foo": ["all", "cows", "eat", "grass"]}`},
+		{`{"/": 9, "~1": 10}`, `[{"op": "test", "path": "/~01", "value": 10}, {"op": "replace", "path": "/~1", "value": 1}]`, `{"/": 1, "~1": 10}`},
+		{`{"foo": 1}`, `[{"op": "replace", "path": "", "value": [1]}]`, `[1]`},
+		{`{"a": [1]}`, `[{"op": "copy", "from": "/a", "path": "/b"}, {"op": "add", "path": "/b/-", "value": 2}]`, `{"a": [1], "b": [1, 2]}`},
+	}
+
+	for _, test := range tests {
+		var doc, want interface{}
+		json.Unmarshal([]byte(test.doc), &doc)
+		json.Unmarshal([]byte(test.want), &want)
+
+		var ops []patchOperation
+		if err := json.Unmarshal([]byte(test.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := applyJSONPatch(doc, ops)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf(`applyJSONPatch(%s, %s) = %v, %v, want %v`, test.doc, test.patch, got, err, want)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+	}{
+		{`{"foo": ["bar"]}`, `[{"op": "add", "path": "/foo/2", "value": 1}]`},
+		{`{"foo": ["bar"]}`, `[{"op": "add", "path": "/foo/01", "value": 1}]`},
+		{`{"foo": ["bar"]}`, `[{"op": "remove", "path": "/foo/-"}]`},
+		{`{"foo": {"bar": 1}}`, `[{"op": "move", "from": "/foo", "path": "/foo/baz"}]`},
+		{`{"foo": 1}`, `[{"op": "add", "path": "/foo/bar", "value": 1}]`},
+		{`{"foo": 1}`, `[{"op": "test", "path": "/bar", "value": null}]`},
+	}
+
+	for _, test := range tests {
+		var doc interface{}
+		json.Unmarshal([]byte(test.doc), &doc)
+
+		var ops []patchOperation
+		json.Unmarshal([]byte(test.patch), &ops)
+
+		if got, err := applyJSONPatch(doc, ops); err == nil {
+			t.Errorf(`applyJSONPatch(%s, %s) = %v, want an error`, test.doc, test.patch, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaRequest is the body of PUT /quotas/:account.
+type quotaRequest struct {
+	Remaining *int `json:"remaining"`
+}
+
+// adjustRequest is the body of POST /quotas/:account/adjust.
+type adjustRequest struct {
+	// By is added to the characters remaining. It may be negative.
+	By *int `json:"by"`
+}
+
+// listQuotas handles GET /quotas, which only admins may see.
+func (s *server) listQuotas(c *gin.Context) {
+	quotas, err := s.store.Quotas(c.Request.Context())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"quotas": quotas})
+}
+
+// getQuota handles GET /quotas/:account. Accounts may see their own
+// quota, and admins every one. Accounts without a quota of their own
+// get the default of the store.
+func (s *server) getQuota(c *gin.Context) {
+	name := c.Param("account")
+	if account, ok := accountOf(c.Request.Context()); ok && !account.Admin && account.Name != name {
+		c.IndentedJSON(http.StatusForbidden, errorDocument{Message: "The quota belongs to another account"})
+		return
+	}
+
+	quota, err := s.store.Quota(c.Request.Context(), name)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, quota)
+}
+
+// putQuota handles PUT /quotas/:account, which sets the characters
+// remaining of the account, whether it had a quota or not.
+func (s *server) putQuota(c *gin.Context) {
+	var req quotaRequest
+	if !decodeBody(c, &req) {
+		return
+	}
+
+	var fieldErr *fieldError
+	switch {
+	case req.Remaining == nil:
+		fieldErr = &fieldError{Field: "remaining", Message: "is required"}
+	case *req.Remaining < 0:
+		fieldErr = &fieldError{Field: "remaining", Message: "must be at least 0"}
+	}
+
+	if fieldErr != nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, errorDocument{Message: "Invalid quota", Errors: []fieldError{*fieldErr}})
+		return
+	}
+
+	quota, err := s.store.SetQuota(c.Request.Context(), c.Param("account"), *req.Remaining)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, quota)
+}
+
+// adjustQuota handles POST /quotas/:account/adjust, which adds to the
+// characters remaining of the account in a single step, so that it
+// doesn't race with the characters being created meanwhile.
+func (s *server) adjustQuota(c *gin.Context) {
+	var req adjustRequest
+	if !decodeBody(c, &req) {
+		return
+	}
+
+	if req.By == nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, errorDocument{
+			Message: "Invalid adjustment",
+			Errors:  []fieldError{{Field: "by", Message: "is required"}},
+		})
+		return
+	}
+
+	quota, err := s.store.AdjustQuota(c.Request.Context(), c.Param("account"), *req.By)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, quota)
+}
+
+// deleteQuota handles DELETE /quotas/:account, after which the account
+// can create as many characters as it likes.
+func (s *server) deleteQuota(c *gin.Context) {
+	if err := s.store.RemoveQuota(c.Request.Context(), c.Param("account")); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{})
+}
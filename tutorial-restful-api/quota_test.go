@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestQuotas(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...), withAuthenticator(testTokens()))
+	admin := bearer(t, "admin", true)
+	alisaie := bearer(t, "alisaie", false)
+	body := `{"name": "Alisaie", "role": "Red Mage", "level": 80}`
+
+	if rec := doWith(router, "PUT", "/quotas/alisaie", `{"remaining": 1}`, alisaie); rec.Code != http.StatusForbidden {
+		t.Fatalf(`PUT /quotas/alisaie by alisaie = %d, want 403`, rec.Code)
+	}
+
+	if rec := doWith(router, "PUT", "/quotas/alisaie", `{"remaining": -1}`, admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf(`PUT /quotas/alisaie with a negative quota = %d, want 422`, rec.Code)
+	}
+
+	if rec := doWith(router, "PUT", "/quotas/alisaie", `{"remaining": 1}`, admin); rec.Code != http.StatusOK {
+		t.Fatalf(`PUT /quotas/alisaie = %d, %s, want 200`, rec.Code, rec.Body)
+	}
+
+	rec := doWith(router, "POST", "/characters", body, alisaie)
+	var created Character
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf(`POST /characters = %d, %s, want 201`, rec.Code, rec.Body)
+	}
+
+	if rec := doWith(router, "POST", "/characters", body, alisaie); rec.Code != http.StatusForbidden {
+		t.Fatalf(`POST /characters over the quota = %d, want 403`, rec.Code)
+	}
+
+	rec = doWith(router, "GET", "/quotas/alisaie", "", alisaie)
+	var quota Quota
+	if err := json.Unmarshal(rec.Body.Bytes(), &quota); err != nil || quota != (Quota{Account: "alisaie"}) {
+		t.Fatalf(`GET /quotas/alisaie = %d, %s, want 0 remaining`, rec.Code, rec.Body)
+	}
+
+	if rec := doWith(router, "GET", "/quotas/admin", "", alisaie); rec.Code != http.StatusForbidden {
+		t.Fatalf(`GET /quotas/admin by alisaie = %d, want 403`, rec.Code)
+	}
+
+	if rec := doWith(router, "POST", "/quotas/alisaie/adjust", `{"by": -1}`, admin); rec.Code != http.StatusConflict {
+		t.Fatalf(`POST /quotas/alisaie/adjust below zero = %d, want 409`, rec.Code)
+	}
+
+	if rec := doWith(router, "POST", "/quotas/alphinaud/adjust", `{"by": 1}`, admin); rec.Code != http.StatusNotFound {
+		t.Fatalf(`POST /quotas/alphinaud/adjust without a quota = %d, want 404`, rec.Code)
+	}
+
+	// Deleting gives the character back.
+	if rec := doWith(router, "DELETE", "/characters/"+created.ID, "", alisaie); rec.Code != http.StatusOK {
+		t.Fatalf(`DELETE /characters/%s = %d, want 200`, created.ID, rec.Code)
+	}
+
+	rec = doWith(router, "POST", "/quotas/alisaie/adjust", `{"by": 2}`, admin)
+	if err := json.Unmarshal(rec.Body.Bytes(), &quota); err != nil || quota.Remaining != 3 {
+		t.Fatalf(`POST /quotas/alisaie/adjust = %d, %s, want 3 remaining`, rec.Code, rec.Body)
+	}
+
+	rec = doWith(router, "GET", "/quotas", "", admin)
+	var list struct{ Quotas []Quota }
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Quotas) != 1 || list.Quotas[0] != quota {
+		t.Fatalf(`GET /quotas = %d, %s, want only alisaie`, rec.Code, rec.Body)
+	}
+
+	if rec := doWith(router, "DELETE", "/quotas/alisaie", "", admin); rec.Code != http.StatusOK {
+		t.Fatalf(`DELETE /quotas/alisaie = %d, want 200`, rec.Code)
+	}
+
+	rec = doWith(router, "GET", "/quotas/alisaie", "", admin)
+	if err := json.Unmarshal(rec.Body.Bytes(), &quota); err != nil || !quota.Unlimited || quota.Default {
+		t.Fatalf(`GET /quotas/alisaie after DELETE = %d, %s, want unlimited`, rec.Code, rec.Body)
+	}
+
+	rec = doWith(router, "GET", "/quotas/alphinaud", "", admin)
+	if err := json.Unmarshal(rec.Body.Bytes(), &quota); err != nil || rec.Code != http.StatusOK || !quota.Default {
+		t.Fatalf(`GET /quotas/alphinaud without a quota = %d, %s, want the default`, rec.Code, rec.Body)
+	}
+}
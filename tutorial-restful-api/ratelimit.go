@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit lets a client make Requests requests per period, in
+// bursts of up to Requests. It's a token bucket: it holds Requests
+// tokens, every request takes one, and they come back one by one over
+// the period.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// rate returns the number of tokens that come back per second.
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// RateLimitResult is what a RateLimiter decided about a request.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of requests that can be made right away.
+	Remaining int
+	// Reset is how long it takes for the bucket to be full again.
+	Reset time.Duration
+	// RetryAfter is how long to wait before the next request is
+	// allowed, when this one isn't.
+	RetryAfter time.Duration
+}
+
+// RateLimiter keeps the buckets of the clients. It's an interface so
+// that the buckets can live somewhere shared, e.g. Redis, when there's
+// more than one server.
+type RateLimiter interface {
+	// Take takes n tokens from the bucket of the key, which has the
+	// given limit. Requests with fewer tokens left aren't allowed,
+	// and take none.
+	Take(ctx context.Context, key string, limit RateLimit, n int) (RateLimitResult, error)
+}
+
+// rateLimits are the limits of the routes, keyed like
+// "POST /characters", with the route template as the path. The
+// routes that aren't in there share a bucket with Default as its
+// limit, unless it's the zero value. Failed authentications take from
+// that bucket too.
+//
+// The limit of createRoute also counts the characters created by
+// batches, whatever their own limit.
+type rateLimits struct {
+	Default RateLimit
+	Routes  map[string]RateLimit
+}
+
+// createRoute is the route that creates characters.
+const createRoute = "POST /characters"
+
+// withRateLimits limits the requests each client makes, as counted by
+// limiter. Clients are told apart by their account, or by their IP
+// address if they have none.
+func withRateLimits(limiter RateLimiter, limits rateLimits) routerOption {
+	return func(s *server) {
+		s.limiter = limiter
+		s.rateLimits = limits
+	}
+}
+
+// limitRate takes a token for the request, and responds with a 429
+// Too Many Requests if there was none left. The RateLimit-* headers,
+// from the IETF draft, tell clients how many they have left. It must
+// come after authenticate, which finds out who the client is.
+func (s *server) limitRate(c *gin.Context) {
+	route := c.Request.Method + " " + c.FullPath()
+	limit, ok := s.rateLimits.Routes[route]
+	if !ok {
+		route, limit = "*", s.rateLimits.Default
+	}
+
+	s.take(c, route, limit, 1)
+}
+
+// limitFailedAuth takes a token from the default bucket of the
+// client's IP address for a request with invalid credentials, so that
+// they can't be guessed faster than the limit allows. Like take, it
+// responds itself and returns false if there was none left.
+func (s *server) limitFailedAuth(c *gin.Context) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	return s.take(c, "*", s.rateLimits.Default, 1)
+}
+
+// limitCreates takes a token per character created by the request
+// from the bucket of createRoute, for the requests that create more
+// than one, such as batches. Like take, it responds itself and returns
+// false if there weren't enough left, or with a 413 Request Entity Too
+// Large if there never can be.
+func (s *server) limitCreates(c *gin.Context, n int) bool {
+	limit, ok := s.rateLimits.Routes[createRoute]
+	if s.limiter == nil || !ok || n == 0 {
+		return true
+	}
+
+	// Waiting wouldn't help, so don't say to retry.
+	if n > limit.Requests {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, errorDocument{
+			Message: fmt.Sprintf("The request creates %d characters, more than the %d allowed per %v", n, limit.Requests, limit.Per),
+		})
+		c.Abort()
+		return false
+	}
+
+	return s.take(c, createRoute, limit, n)
+}
+
+// take takes n tokens from the bucket of the client for the route,
+// which has the given limit. If there weren't enough left, it responds
+// with a 429 Too Many Requests, aborts and returns false.
+func (s *server) take(c *gin.Context, route string, limit RateLimit, n int) bool {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return true
+	}
+
+	client := "ip:" + c.ClientIP()
+	if account, ok := accountOf(c.Request.Context()); ok {
+		client = "account:" + account.Name
+	}
+
+	result, err := s.limiter.Take(c.Request.Context(), route+" "+client, limit, n)
+	if err != nil {
+		// Don't let an outage of the limiter take the API down.
+		c.Error(fmt.Errorf("limitRate: %v", err))
+		return true
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", seconds(result.Reset))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Requests, seconds(limit.Per)))
+
+	if !result.Allowed {
+		c.Header("Retry-After", seconds(result.RetryAfter))
+		c.IndentedJSON(http.StatusTooManyRequests, errorDocument{Message: "Too many requests"})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// seconds formats d as a number of seconds, rounded up so that clients
+// waiting that long don't come back too early.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// sweepEvery is how often memoryRateLimiter forgets the buckets that
+// are full, which are the same as no bucket at all.
+const sweepEvery = time.Minute
+
+// memoryRateLimiter keeps the buckets in a map, guarded by a mutex.
+// Each server has its own, so clients get the limits from each one.
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	// updated is when tokens was last worked out.
+	updated time.Time
+	// full is when the bucket will be full, if nothing takes from it.
+	full time.Time
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (l *memoryRateLimiter) Take(ctx context.Context, key string, limit RateLimit, n int) (RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	capacity, rate := float64(limit.Requests), limit.rate()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	var result RateLimitResult
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = duration((float64(n) - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = duration((capacity - b.tokens) / rate)
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// sweep forgets the buckets that are full, once in a while. The
+// caller must hold the lock.
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepEvery {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.swept = now
+}
+
+// duration turns a number of seconds into a time.Duration.
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
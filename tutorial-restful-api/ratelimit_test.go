@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1e9, 0)
+	limiter := newMemoryRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := RateLimit{Requests: 3, Per: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		result, _ := limiter.Take(ctx, "alisaie", limit, 1)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf(`Take within the burst = %+v, want allowed with %d remaining`, result, i)
+		}
+	}
+
+	result, _ := limiter.Take(ctx, "alisaie", limit, 1)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf(`Take over the burst = %+v, want denied for a second`, result)
+	}
+
+	if result, _ := limiter.Take(ctx, "alphinaud", limit, 1); !result.Allowed {
+		t.Fatalf(`Take for another key = %+v, want allowed`, result)
+	}
+
+	now = now.Add(time.Second)
+	if result, _ := limiter.Take(ctx, "alisaie", limit, 1); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf(`Take a second later = %+v, want allowed with 0 remaining`, result)
+	}
+
+	// Full buckets are forgotten.
+	now = now.Add(sweepEvery)
+	limiter.Take(ctx, "alisaie", limit, 1)
+	if len(limiter.buckets) != 1 {
+		t.Fatalf(`%d buckets after a sweep, want 1`, len(limiter.buckets))
+	}
+}
+
+func TestRateLimitEndpoint(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...), withAuthenticator(testTokens()), withRateLimits(newMemoryRateLimiter(), rateLimits{
+		Default: RateLimit{Requests: 5, Per: time.Minute},
+		Routes:  map[string]RateLimit{"POST /characters": {Requests: 1, Per: time.Minute}},
+	}))
+	alisaie := bearer(t, "alisaie", false)
+
+	rec := doWith(router, "POST", "/characters", `{"name": "Alisaie", "level": 80}`, alisaie)
+	if rec.Code != http.StatusCreated || rec.Header().Get("RateLimit-Limit") != "1" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf(`POST /characters = %d, %v, want 201 with the limit in the headers`, rec.Code, rec.Header())
+	}
+
+	rec = doWith(router, "POST", "/characters", `{"name": "Alphinaud", "level": 80}`, alisaie)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf(`POST /characters over the limit = %d, %v, want 429 and to retry in 60s`, rec.Code, rec.Header())
+	}
+
+	// Other accounts and routes have their own buckets.
+	if rec := doWith(router, "POST", "/characters", `{"name": "Alphinaud", "level": 80}`, bearer(t, "alphinaud", false)); rec.Code != http.StatusCreated {
+		t.Fatalf(`POST /characters by another account = %d, want 201`, rec.Code)
+	}
+
+	for i := 0; i < 5; i++ {
+		if rec := doWith(router, "GET", "/characters", "", alisaie); rec.Code != http.StatusOK {
+			t.Fatalf(`GET /characters #%d = %d, want 200`, i+1, rec.Code)
+		}
+	}
+
+	// Without an account, clients are told apart by their IP address.
+	if rec := do(router, "GET", "/characters/"+seedCharacters[0].ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf(`GET /characters/:id without credentials = %d, want 200`, rec.Code)
+	}
+
+	if rec := doWith(router, "GET", "/characters/"+seedCharacters[0].ID, "", alisaie); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf(`GET /characters/:id over the default limit = %d, want 429`, rec.Code)
+	}
+}
+
+func TestRateLimitBypasses(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...), withAuthenticator(testTokens()), withRateLimits(newMemoryRateLimiter(), rateLimits{
+		Default: RateLimit{Requests: 2, Per: time.Minute},
+		Routes:  map[string]RateLimit{createRoute: {Requests: 3, Per: time.Minute}},
+	}))
+
+	// Guessing credentials takes from the bucket of the address.
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		rec := doWith(router, "GET", "/characters", "", map[string]string{"Authorization": "Bearer guess"})
+		if rec.Code != want {
+			t.Fatalf(`GET /characters with invalid credentials #%d = %d, want %d`, i+1, rec.Code, want)
+		}
+	}
+
+	// X-Forwarded-For doesn't make for a new client.
+	if rec := doWith(router, "GET", "/characters", "", map[string]string{"X-Forwarded-For": "203.0.113.7"}); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf(`GET /characters with a made-up X-Forwarded-For = %d, want 429`, rec.Code)
+	}
+
+	// Batches take a token per character they create.
+	alisaie := bearer(t, "alisaie", false)
+	batch := `{"operations": [
+		{"op": "create", "character": {"name": "Alisaie", "level": 80}},
+		{"op": "create", "character": {"name": "Alphinaud", "level": 80}}
+	]}`
+	if rec := doWith(router, "POST", "/characters:batch", batch, alisaie); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf(`POST /characters:batch = %d, %v, want 200 with 1 create remaining`, rec.Code, rec.Header())
+	}
+
+	if rec := doWith(router, "POST", "/characters", `{"name": "Estinien", "level": 90}`, alisaie); rec.Code != http.StatusCreated {
+		t.Fatalf(`POST /characters with 1 create remaining = %d, want 201`, rec.Code)
+	}
+
+	if rec := doWith(router, "POST", "/characters", `{"name": "Thancred", "level": 80}`, alisaie); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf(`POST /characters with no create remaining = %d, want 429`, rec.Code)
+	}
+}
+
+func TestRateLimitBatchTooLarge(t *testing.T) {
+	router := newRouter(newMemoryStore(), withAuthenticator(testTokens()), withRateLimits(newMemoryRateLimiter(), rateLimits{
+		Default: RateLimit{Requests: 10, Per: time.Minute},
+		Routes:  map[string]RateLimit{createRoute: {Requests: 1, Per: time.Minute}},
+	}))
+
+	batch := `{"operations": [
+		{"op": "create", "character": {"name": "Alisaie", "level": 80}},
+		{"op": "create", "character": {"name": "Alphinaud", "level": 80}}
+	]}`
+	rec := doWith(router, "POST", "/characters:batch", batch, bearer(t, "alisaie", false))
+	if rec.Code != http.StatusRequestEntityTooLarge || rec.Header().Get("Retry-After") != "" {
+		t.Fatalf(`POST /characters:batch over the limit of a window = %d, %v, want 413 without Retry-After`, rec.Code, rec.Header())
+	}
+}
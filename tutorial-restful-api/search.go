@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Searcher is implemented by stores that can search characters by
+// partial name or role.
+type Searcher interface {
+	// Search returns the characters matching every word of the query,
+	// most relevant first. The last word may be partial, e.g. "chief
+	// of the bur".
+	Search(ctx context.Context, query string) ([]Character, error)
+}
+
+// searchCharacters handles GET /characters/search?q=...&limit=...,
+// returning the most relevant characters first.
+func (s *server) searchCharacters(c *gin.Context) {
+	searcher, ok := s.store.(Searcher)
+	if !ok {
+		c.IndentedJSON(http.StatusNotImplemented, errorDocument{Message: "Search isn't available"})
+		return
+	}
+
+	query, limit, err := parseSearchQuery(c.Request.URL.Query())
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	results, err := searcher.Search(c.Request.Context(), query)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"characters": results, "total": total})
+}
+
+// parseSearchQuery reads the query parameters of a search, as
+// parseListQuery does for GET /characters. Invalid ones get a
+// *clientError for a 400 Bad Request.
+func parseSearchQuery(values url.Values) (string, int, error) {
+	var errs []fieldError
+	query := values.Get("q")
+	if strings.TrimSpace(query) == "" {
+		errs = append(errs, fieldError{Field: "q", Message: "is required"})
+	}
+
+	limit := defaultLimit
+	if v, ok := values["limit"]; ok {
+		var err error
+		if limit, err = strconv.Atoi(v[0]); err != nil || limit < 1 || limit > maxLimit {
+			errs = append(errs, fieldError{Field: "limit", Message: fmt.Sprintf("must be an integer between 1 and %d", maxLimit)})
+		}
+	}
+
+	if len(errs) > 0 {
+		return "", 0, &clientError{
+			status: http.StatusBadRequest,
+			doc:    errorDocument{Message: "Invalid query parameters", Errors: errs},
+		}
+	}
+
+	return query, limit, nil
+}
+
+// How much a word matters depending on where it's found.
+const (
+	nameWeight = 2.0
+	roleWeight = 1.0
+	// A word that only starts like the query word counts for less.
+	prefixWeight = 0.5
+)
+
+// indexedStore is a CharacterStore that keeps an inverted index of the
+// names and roles of the characters in another store, so that it can
+// search them.
+type indexedStore struct {
+	CharacterStore
+
+	index *searchIndex
+
+	// mu guards what follows. It's only held while updating the index,
+	// so writes to the store run concurrently and may finish in any
+	// order: the index only takes the latest version of each character.
+	mu sync.Mutex
+	// versions holds the version indexed for each character.
+	versions map[string]int
+	// deleted holds the characters deleted while other writes were
+	// running, so that those can't bring them back. It's emptied once
+	// no write is running.
+	deleted map[string]bool
+	// writes is the number of writes running.
+	writes int
+}
+
+// newIndexedStore indexes the characters in store, which must not be
+// written to other than through the returned store.
+func newIndexedStore(ctx context.Context, store CharacterStore) (*indexedStore, error) {
+	characters, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("newIndexedStore: %v", err)
+	}
+
+	s := &indexedStore{
+		CharacterStore: store,
+		index:          newSearchIndex(),
+		versions:       make(map[string]int),
+		deleted:        make(map[string]bool),
+	}
+	for _, char := range characters {
+		s.put(char)
+	}
+
+	return s, nil
+}
+
+func (s *indexedStore) Create(ctx context.Context, char Character) (Character, error) {
+	s.begin()
+	defer s.end()
+
+	char, err := s.CharacterStore.Create(ctx, char)
+	if err == nil {
+		s.put(char)
+	}
+
+	return char, err
+}
+
+func (s *indexedStore) Update(ctx context.Context, id string, update UpdateFunc) (Character, error) {
+	s.begin()
+	defer s.end()
+
+	char, err := s.CharacterStore.Update(ctx, id, update)
+	if err == nil {
+		s.put(char)
+	}
+
+	return char, err
+}
+
+func (s *indexedStore) Delete(ctx context.Context, id string, check CheckFunc) error {
+	s.begin()
+	defer s.end()
+
+	err := s.CharacterStore.Delete(ctx, id, check)
+	if err == nil {
+		s.remove(id)
+	}
+
+	return err
+}
+
+func (s *indexedStore) Apply(ctx context.Context, ops []Operation) ([]Character, error) {
+	s.begin()
+	defer s.end()
+
+	results, err := s.CharacterStore.Apply(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, op := range ops {
+		if op.Op == opDelete {
+			s.remove(op.ID)
+		} else {
+			s.put(results[idx])
+		}
+	}
+
+	return results, nil
+}
+
+// begin records that a write is running.
+func (s *indexedStore) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writes++
+}
+
+// end records that a write is done. The characters deleted until then
+// can't be written anymore, so there's no need to remember them.
+func (s *indexedStore) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writes--; s.writes == 0 {
+		s.deleted = make(map[string]bool)
+	}
+}
+
+// put indexes char, unless a later version of it, or its deletion, is
+// already indexed.
+func (s *indexedStore) put(char Character) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version, ok := s.versions[char.ID]; s.deleted[char.ID] || ok && char.Version <= version {
+		return
+	}
+
+	s.versions[char.ID] = char.Version
+	s.index.put(char)
+}
+
+// remove drops the character with the given ID from the index.
+func (s *indexedStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleted[id] = true
+	delete(s.versions, id)
+	s.index.remove(id)
+}
+
+func (s *indexedStore) Search(ctx context.Context, query string) ([]Character, error) {
+	return s.index.search(query), nil
+}
+
+// field is a bit set of where a word appears in a character.
+type field uint8
+
+const (
+	fieldName field = 1 << iota
+	fieldRole
+)
+
+// searchIndex maps the words in the names and roles of characters to
+// the characters. It is safe for concurrent use.
+type searchIndex struct {
+	mu sync.RWMutex
+	// postings maps each word to the IDs of the characters it
+	// appears in, and where.
+	postings map[string]map[string]field
+	// words holds the keys of postings, sorted, to find the words
+	// starting with a prefix.
+	words      []string
+	characters map[string]Character
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings:   make(map[string]map[string]field),
+		characters: make(map[string]Character),
+	}
+}
+
+// put indexes char, replacing what was indexed under its ID.
+func (idx *searchIndex) put(char Character) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(char.ID)
+	idx.characters[char.ID] = char
+
+	for f, text := range map[field]string{fieldName: char.Name, fieldRole: char.Role} {
+		for _, word := range tokenize(text) {
+			ids, ok := idx.postings[word]
+			if !ok {
+				ids = make(map[string]field)
+				idx.postings[word] = ids
+
+				at := sort.SearchStrings(idx.words, word)
+				idx.words = append(idx.words, "")
+				copy(idx.words[at+1:], idx.words[at:])
+				idx.words[at] = word
+			}
+
+			ids[char.ID] |= f
+		}
+	}
+}
+
+func (idx *searchIndex) remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(id)
+}
+
+func (idx *searchIndex) removeLocked(id string) {
+	char, ok := idx.characters[id]
+	if !ok {
+		return
+	}
+
+	delete(idx.characters, id)
+
+	for _, word := range tokenize(char.Name + " " + char.Role) {
+		ids := idx.postings[word]
+		delete(ids, id)
+
+		if len(ids) == 0 && ids != nil {
+			delete(idx.postings, word)
+
+			at := sort.SearchStrings(idx.words, word)
+			idx.words = append(idx.words[:at], idx.words[at+1:]...)
+		}
+	}
+}
+
+// search returns the characters matching every word of the query,
+// ranked by how rare the matching words are and where they appear.
+// Words are matched by prefix: "hyth" finds "Hythlodaeus".
+func (idx *searchIndex) search(query string) []Character {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[string]float64
+
+	for _, queryWord := range tokenize(query) {
+		matches := make(map[string]float64)
+
+		at := sort.SearchStrings(idx.words, queryWord)
+		for _, word := range idx.words[at:] {
+			if !strings.HasPrefix(word, queryWord) {
+				break
+			}
+
+			ids := idx.postings[word]
+			// Inverse document frequency: rare words say more about
+			// what is being looked for.
+			weight := math.Log(1 + float64(len(idx.characters))/float64(len(ids)))
+			if word != queryWord {
+				weight *= prefixWeight
+			}
+
+			for id, f := range ids {
+				score := 0.0
+				if f&fieldName != 0 {
+					score += nameWeight * weight
+				}
+
+				if f&fieldRole != 0 {
+					score += roleWeight * weight
+				}
+
+				// A query word matching several words only counts
+				// for the best of them.
+				if score > matches[id] {
+					matches[id] = score
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = matches
+			continue
+		}
+
+		// Every query word has to match.
+		for id, score := range scores {
+			if match, ok := matches[id]; ok {
+				scores[id] = score + match
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]Character, 0, len(scores))
+	for id := range scores {
+		results = append(results, idx.characters[id])
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if scores[a.ID] != scores[b.ID] {
+			return scores[a.ID] > scores[b.ID]
+		}
+
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+
+		return a.ID < b.ID
+	})
+
+	return results
+}
+
+// apostrophes are dropped rather than splitting words, so that
+// "Y'shtola" is a single word.
+var apostrophes = strings.NewReplacer("'", "", "’", "")
+
+// tokenize splits text into words, folding their case so that e.g.
+// "ß" and "SS" match.
+func tokenize(text string) []string {
+	// Casers aren't safe for concurrent use.
+	text = cases.Fold().String(norm.NFC.String(apostrophes.Replace(text)))
+
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func init() {
+	storeFactories["indexed"] = func(t *testing.T) CharacterStore {
+		return mustIndex(t, newMemoryStore())
+	}
+}
+
+func mustIndex(t *testing.T, store CharacterStore) *indexedStore {
+	t.Helper()
+
+	indexed, err := newIndexedStore(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return indexed
+}
+
+func TestSearch(t *testing.T) {
+	store := mustIndex(t, listCharactersStore())
+	ctx := context.Background()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"hades", "Hades"},
+		{"HYTH", "Hythlodaeus"},
+		{"Chief of the Bureau", "Hythlodaeus"},
+		{"chief of the bur", "Hythlodaeus"},
+		{"y'sh", "Y'shtola"},
+		{"yshtola", "Y'shtola"},
+		{"scion", "Thancred,Urianger,Y'shtola"},
+		{"scion th", "Thancred"},
+		{"azem hades", ""},
+		{"  ", ""},
+	}
+
+	for _, test := range tests {
+		results, err := store.Search(ctx, test.query)
+		if got := names(results); got != test.want || err != nil {
+			t.Errorf(`Search(%q) = %s, %v, want %s, nil`, test.query, got, err, test.want)
+		}
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	store := mustIndex(t, newMemoryStore(
+		Character{ID: "1", Name: "Alisaie", Role: "Scion of the Seventh Dawn", Level: 80},
+		Character{ID: "2", Name: "Dawn", Role: "Warrior", Level: 50},
+		Character{ID: "3", Name: "Dawnbringer", Role: "Warrior", Level: 50},
+	))
+
+	// An exact word beats a prefix, and a name beats a role.
+	results, _ := store.Search(context.Background(), "dawn")
+	if got := names(results); got != "Dawn,Dawnbringer,Alisaie" {
+		t.Fatalf(`Search("dawn") = %s, want Dawn,Dawnbringer,Alisaie`, got)
+	}
+}
+
+func TestSearchFollowsWrites(t *testing.T) {
+	store := mustIndex(t, newMemoryStore())
+	ctx := context.Background()
+
+	search := func(query string) string {
+		results, _ := store.Search(ctx, query)
+		return names(results)
+	}
+
+	char, _ := store.Create(ctx, Character{Name: "Hades", Role: "Emet-Selch", Level: 99})
+	if got := search("emet"); got != "Hades" {
+		t.Fatalf(`Search("emet") after Create = %s, want Hades`, got)
+	}
+
+	char.Name = "Solus"
+	store.Update(ctx, char.ID, replaceWith(char))
+	if got := search("hades"); got != "" {
+		t.Fatalf(`Search("hades") after renaming = %s, want nothing`, got)
+	}
+
+	if got := search("solus"); got != "Solus" {
+		t.Fatalf(`Search("solus") after renaming = %s, want Solus`, got)
+	}
+
+	// A failed update leaves the index alone.
+	store.Update(ctx, char.ID, func(Character) (Character, error) {
+		return Character{Name: "Emet"}, fmt.Errorf("nope")
+	})
+	if got := search("solus"); got != "Solus" {
+		t.Fatalf(`Search("solus") after a failed update = %s, want Solus`, got)
+	}
+
+	results, _ := store.Apply(ctx, []Operation{
+		{Op: opCreate, Character: Character{Name: "Emet-Selch", Level: 99}},
+		{Op: opDelete, ID: char.ID},
+	})
+	if got := search("solus"); got != "" {
+		t.Fatalf(`Search("solus") after Apply = %s, want nothing`, got)
+	}
+
+	store.Delete(ctx, results[0].ID, nil)
+	if got := search("emet"); got != "" {
+		t.Fatalf(`Search("emet") after Delete = %s, want nothing`, got)
+	}
+
+	if len(store.index.words) != 0 || len(store.index.postings) != 0 {
+		t.Fatalf(`The index still holds %v after deleting everything`, store.index.words)
+	}
+}
+
+// TestSearchOutOfOrder checks that writes finishing in another order
+// than the store made them don't leave the index behind.
+func TestSearchOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	store := mustIndex(t, newMemoryStore())
+	venat := Character{ID: "venat", Name: "Venat", Role: "Azem", Version: 3}
+
+	store.put(venat)
+	store.put(Character{ID: "venat", Name: "Venat", Role: "Hydaelyn", Version: 2})
+	if results, _ := store.Search(ctx, "azem"); len(results) != 1 || results[0] != venat {
+		t.Fatalf(`Search("azem") after an older version = %+v, want version 3`, results)
+	}
+
+	// A write that was running when the character got deleted can't
+	// bring it back.
+	store.begin()
+	store.remove(venat.ID)
+	store.put(Character{ID: "venat", Name: "Venat", Role: "Azem", Version: 4})
+	store.end()
+	if results, _ := store.Search(ctx, "venat"); len(results) != 0 {
+		t.Fatalf(`Search("venat") after a deletion = %+v, want nothing`, results)
+	}
+
+	if len(store.deleted) != 0 {
+		t.Fatalf(`%d deleted characters remembered once no write is running, want 0`, len(store.deleted))
+	}
+}
+
+// TestSearchConcurrent searches while writing. Run it with -race.
+func TestSearchConcurrent(t *testing.T) {
+	store := mustIndex(t, newMemoryStore())
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			char, _ := store.Create(ctx, Character{Name: fmt.Sprintf("Scion %d", i), Role: "Scion", Level: 1})
+			if i%2 == 0 {
+				store.Delete(ctx, char.ID, nil)
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			store.Search(ctx, "scion")
+		}
+	}()
+
+	wg.Wait()
+
+	if results, _ := store.Search(ctx, "scion"); len(results) != 50 {
+		t.Fatalf(`Search("scion") returned %d characters, want 50`, len(results))
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	router := newRouter(mustIndex(t, listCharactersStore()))
+
+	rec := do(router, "GET", "/characters/search?q=scion&limit=2", "")
+	var body struct {
+		Characters []Character `json:"characters"`
+		Total      int         `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body.Characters) != 2 || body.Total != 3 {
+		t.Fatalf(`GET /characters/search?q=scion&limit=2 = %d, %s, want 2 of 3 characters`, rec.Code, rec.Body)
+	}
+
+	for _, query := range []string{"", "q=", "q=scion&limit=0"} {
+		if rec := do(router, "GET", "/characters/search?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf(`GET /characters/search?%s = %d, want 400`, query, rec.Code)
+		}
+	}
+
+	// Stores that can't search get indexed.
+	router = newRouter(listCharactersStore())
+	if rec := do(router, "GET", "/characters/search?q=scion", ""); rec.Code != http.StatusOK {
+		t.Fatalf(`GET /characters/search without an index = %d, want 200`, rec.Code)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrCharacterNotFound is returned by a CharacterStore when there's
+// no character with the given ID.
+var ErrCharacterNotFound = errors.New("character not found")
+
+// ErrNoCharactersRemaining is returned when creating a character
+// while its owner has used up its quota.
+var ErrNoCharactersRemaining = errors.New("no characters remaining")
+
+// ErrNameTaken is returned when a character would get the name of
+// another one. The error is a *NameTakenError, which says which.
+var ErrNameTaken = errors.New("name taken")
+
+// ErrQuotaNotFound is returned when changing the quota of an account
+// that has none.
+var ErrQuotaNotFound = errors.New("quota not found")
+
+// ErrQuotaTooLow is returned when adjusting a quota below zero.
+var ErrQuotaTooLow = errors.New("quota too low")
+
+// CharacterStore is where the characters live. Implementations must
+// be safe for concurrent use, since gin serves every request in its
+// own goroutine.
+//
+// Names are unique, regardless of case and Unicode normalization: see
+// nameKey.
+//
+// It also keeps the quotas of the accounts: creating a character uses
+// up one of its owner's, and deleting it gives it back. Accounts whose
+// quota was removed have no limit, while those that never had one get
+// the default of the store.
+type CharacterStore interface {
+	// List returns every character, in creation order.
+	List(ctx context.Context) ([]Character, error)
+	// Get returns the character with the given ID.
+	Get(ctx context.Context, id string) (Character, error)
+	// Create stores a new character, assigning it an ID. Its version
+	// starts at 1. If its owner has no characters remaining, it fails
+	// with ErrNoCharactersRemaining, and if its name is taken, with
+	// a *NameTakenError.
+	Create(ctx context.Context, char Character) (Character, error)
+	// Update replaces the character with the given ID by what update
+	// returns, atomically: no other change to the character can
+	// happen in between. If update returns an error, the character is
+	// left alone and the error is returned as is. The ID and owner
+	// can't be changed, and the version is incremented. Like Create,
+	// it fails with a *NameTakenError if the new name is taken.
+	Update(ctx context.Context, id string, update UpdateFunc) (Character, error)
+	// Delete removes the character with the given ID, once check, if
+	// not nil, approves of its current state. If check returns an
+	// error, the character is left alone and the error is returned
+	// as is.
+	Delete(ctx context.Context, id string, check CheckFunc) error
+	// Revisions returns the last revisions of the character with the
+	// given ID, oldest first. Every change made by Create and Update
+	// adds one, and Delete drops them all.
+	Revisions(ctx context.Context, id string) ([]Revision, error)
+	// Apply runs the operations in order, as a whole: either they all
+	// succeed, or none of them has any effect, and the error is an
+	// *OperationError. Later operations see the changes made by the
+	// earlier ones. It returns the character created or updated by
+	// each operation, and an empty one for deletions.
+	Apply(ctx context.Context, ops []Operation) ([]Character, error)
+
+	// Quotas returns the quotas of the accounts that have one, by
+	// account name.
+	Quotas(ctx context.Context) ([]Quota, error)
+	// Quota returns the quota of the account: its own, no limit if it
+	// was removed, or the default of the store if it never had one.
+	Quota(ctx context.Context, account string) (Quota, error)
+	// SetQuota gives the account the number of characters remaining.
+	SetQuota(ctx context.Context, account string, remaining int) (Quota, error)
+	// AdjustQuota adds delta to the quota of the account, atomically.
+	// It fails with ErrQuotaNotFound if there's no quota to adjust,
+	// and with ErrQuotaTooLow if it would go below zero.
+	AdjustQuota(ctx context.Context, account string, delta int) (Quota, error)
+	// RemoveQuota removes the quota of the account, which can then
+	// create as many characters as it likes. It fails with
+	// ErrQuotaNotFound if there's none.
+	RemoveQuota(ctx context.Context, account string) error
+}
+
+// Quota is how many more characters an account can create.
+type Quota struct {
+	Account   string `json:"account"`
+	Remaining int    `json:"remaining"`
+	// Unlimited means that there's no limit, whatever Remaining says.
+	Unlimited bool `json:"unlimited,omitempty"`
+	// Default means that the account has no quota of its own, and
+	// gets the default of the store.
+	Default bool `json:"default,omitempty"`
+}
+
+// The kinds of Operation.
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// Operation is a change made as part of CharacterStore.Apply, which
+// does what the method of the same name would do.
+type Operation struct {
+	// Op is opCreate, opUpdate or opDelete.
+	Op string
+	// ID is the character to update or delete.
+	ID string
+	// Character is the character to create.
+	Character Character
+	// Update is used by opUpdate, and Check, which may be nil, by
+	// opDelete.
+	Update UpdateFunc
+	Check  CheckFunc
+}
+
+// OperationError is the error of the operation that made a call to
+// CharacterStore.Apply fail.
+type OperationError struct {
+	// Index is the position of the operation.
+	Index int
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// NameTakenError is the error of a character getting the name of
+// another one.
+type NameTakenError struct {
+	Name string
+	// ID is the one of the character that has the name.
+	ID string
+}
+
+func (e *NameTakenError) Error() string {
+	return fmt.Sprintf("%v: %q is the name of %s", ErrNameTaken, e.Name, e.ID)
+}
+
+func (e *NameTakenError) Unwrap() error {
+	return ErrNameTaken
+}
+
+// nameKey returns what names are compared by: two characters can't
+// have the same. It folds the case, so that "HADES" and "hades" are
+// the same name, and normalizes to NFC, so that an "é" typed as "e"
+// followed by a combining accent is the same as the single "é".
+// tutorial-relational-db has a copy, which must stay the same.
+func nameKey(name string) string {
+	// Casers aren't safe for concurrent use.
+	return norm.NFC.String(cases.Fold().String(norm.NFC.String(name)))
+}
+
+// UpdateFunc computes the new state of a character from its current
+// one. It may be called while the store holds a lock, so it must not
+// call the store itself.
+type UpdateFunc func(current Character) (Character, error)
+
+// CheckFunc decides whether a character can be deleted. Like an
+// UpdateFunc, it must not call the store itself.
+type CheckFunc func(current Character) error
+
+// guard returns an UpdateFunc that only runs update once check, if
+// not nil, approves of the current state of the character.
+func guard(check CheckFunc, update UpdateFunc) UpdateFunc {
+	if check == nil {
+		return update
+	}
+
+	return func(current Character) (Character, error) {
+		if err := check(current); err != nil {
+			return Character{}, err
+		}
+
+		return update(current)
+	}
+}
+
+// allOf returns a CheckFunc that approves of what all the checks that
+// aren't nil approve of, or nil if there are none.
+func allOf(checks ...CheckFunc) CheckFunc {
+	var nonNil []CheckFunc
+	for _, check := range checks {
+		if check != nil {
+			nonNil = append(nonNil, check)
+		}
+	}
+
+	if len(nonNil) == 0 {
+		return nil
+	}
+
+	return func(current Character) error {
+		for _, check := range nonNil {
+			if err := check(current); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// replaceWith returns an UpdateFunc that replaces the character with
+// char, whatever its current state.
+func replaceWith(char Character) UpdateFunc {
+	return func(Character) (Character, error) {
+		return char, nil
+	}
+}
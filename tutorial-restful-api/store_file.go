@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// compactAfter is the number of records appended to the log after
+// which it gets compacted, as long as most of them are stale.
+const compactAfter = 1000
+
+// Operations recorded in the log.
+const (
+	recordPut    = "put"
+	recordDelete = "delete"
+	// A batch holds the records of a call to Apply, so that they make
+	// it to the log, or not, as a whole.
+	recordBatch = "batch"
+	// A quota record sets the quota of an account, or removes it.
+	recordQuota = "quota"
+)
+
+// logRecord is a single line of the log.
+type logRecord struct {
+	Op        string     `json:"op"`
+	ID        string     `json:"id,omitempty"`
+	Character *Character `json:"character,omitempty"`
+	// Who made the change, and when. Older logs don't have them.
+	Author  string      `json:"author,omitempty"`
+	Time    time.Time   `json:"time"`
+	Records []logRecord `json:"records,omitempty"`
+	Account string      `json:"account,omitempty"`
+	// Remaining is nil when the quota of the account is removed.
+	Remaining *int `json:"remaining,omitempty"`
+}
+
+// putRecord returns the record storing the revision.
+func putRecord(rev Revision) logRecord {
+	return logRecord{Op: recordPut, Character: &rev.Character, Author: rev.Author, Time: rev.Time}
+}
+
+// deleteRecord returns the record deleting the character with the
+// given ID, by the author of ctx.
+func deleteRecord(ctx context.Context, id string) logRecord {
+	return logRecord{Op: recordDelete, ID: id, Author: authorOf(ctx), Time: time.Now().UTC()}
+}
+
+// quotaRecord returns the record setting the quota of the account,
+// or removing it if remaining is nil.
+func quotaRecord(ctx context.Context, account string, remaining *int) logRecord {
+	return logRecord{Op: recordQuota, Account: account, Remaining: remaining, Author: authorOf(ctx), Time: time.Now().UTC()}
+}
+
+// changes returns the number of changes in the record.
+func (r logRecord) changes() int {
+	if r.Op == recordBatch {
+		return len(r.Records)
+	}
+
+	return 1
+}
+
+// fileStore keeps the characters in memory and records every change
+// in an append-only log of JSON lines, so that they survive restarts.
+// Changes only become visible once they've been synced to disk.
+//
+// The log is compacted from time to time by writing the revisions of
+// the current characters to a temporary file and renaming it over the
+// log, so a crash leaves either the old log or the new one in place.
+type fileStore struct {
+	// mu serializes the writes, so that the log and the characters
+	// in memory change in the same order. Reads only need the lock
+	// of the memory store.
+	mu   sync.Mutex
+	mem  *memoryStore
+	path string
+	file *os.File
+	// records is the number of changes in the log.
+	records int
+	// size is the length of the log, up to the last record that made
+	// it to disk.
+	size int64
+	// broken is why the log can't be appended to anymore, if a
+	// compaction failed after replacing it. Every write fails with it
+	// from then on, rather than going to a file that may not survive
+	// a restart.
+	broken error
+	// syncDir makes the renames in a directory durable. Tests replace
+	// it to make compactions fail.
+	syncDir func(path string) error
+}
+
+// openFileStore opens the log at path, replaying it to recover the
+// characters. If there's no log yet, one is created holding the
+// given seed characters.
+func openFileStore(path string, seed ...Character) (*fileStore, error) {
+	s := &fileStore{mem: newMemoryStore(), path: path, syncDir: syncPath}
+
+	_, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		for _, char := range seed {
+			s.mem.put(newRevision(context.Background(), char))
+		}
+
+		if err := s.compact(); err != nil {
+			return nil, fmt.Errorf("openFileStore: %v", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("openFileStore: %v", err)
+	default:
+		if err := s.recover(); err != nil {
+			return nil, fmt.Errorf("openFileStore: %v", err)
+		}
+
+		s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return nil, fmt.Errorf("openFileStore: %v", err)
+		}
+	}
+
+	return s, nil
+}
+
+// recover replays the log. A crash in the middle of an append can
+// leave the last line incomplete: since that change was never
+// acknowledged, it's dropped and cut off the log.
+func (s *fileStore) recover() error {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	// good is the length of the log up to the last complete record.
+	good := 0
+	for line := 1; good < len(content); line++ {
+		end := bytes.IndexByte(content[good:], '\n')
+		if end == -1 {
+			break
+		}
+
+		var record logRecord
+		if err := json.Unmarshal(content[good:good+end], &record); err != nil {
+			return fmt.Errorf("%s: record %d: %v", s.path, line, err)
+		}
+
+		// Logs written before characters had versions.
+		if record.Character != nil && record.Character.Version == 0 {
+			record.Character.Version = 1
+			if current, err := s.mem.Get(context.Background(), record.Character.ID); err == nil {
+				record.Character.Version = current.Version + 1
+			}
+		}
+
+		if err := s.replay(record); err != nil {
+			return fmt.Errorf("%s: record %d: %v", s.path, line, err)
+		}
+
+		s.records += record.changes()
+		good += end + 1
+	}
+
+	s.size = int64(good)
+	if good == len(content) {
+		return nil
+	}
+
+	if err := os.Truncate(s.path, int64(good)); err != nil {
+		return err
+	}
+
+	return syncPath(s.path)
+}
+
+// replay applies a record to the characters in memory.
+func (s *fileStore) replay(record logRecord) error {
+	switch {
+	case record.Op == recordPut && record.Character != nil:
+		s.mem.put(Revision{Character: *record.Character, Author: record.Author, Time: record.Time})
+	case record.Op == recordDelete:
+		s.mem.remove(record.ID)
+	case record.Op == recordQuota && record.Account != "":
+		s.mem.setQuota(record.Account, record.Remaining)
+	case record.Op == recordBatch:
+		for _, r := range record.Records {
+			if err := s.replay(r); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid record %+v", record)
+	}
+
+	return nil
+}
+
+func (s *fileStore) List(ctx context.Context) ([]Character, error) {
+	return s.mem.List(ctx)
+}
+
+func (s *fileStore) Get(ctx context.Context, id string) (Character, error) {
+	return s.mem.Get(ctx, id)
+}
+
+func (s *fileStore) Create(ctx context.Context, char Character) (Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only writes change the quotas and the names, and we're holding
+	// s.mu, so there's no need to lock.
+	if quota := s.mem.quotaOf(char.Owner); !quota.Unlimited && quota.Remaining <= 0 {
+		return Character{}, fmt.Errorf("Create: %w for %s", ErrNoCharactersRemaining, char.Owner)
+	}
+
+	if err := s.mem.checkName(char.Name, ""); err != nil {
+		return Character{}, err
+	}
+
+	char.ID = uuid.New().String()
+	char.Version = 1
+	if err := s.write(putRecord(newRevision(ctx, char))); err != nil {
+		return Character{}, err
+	}
+
+	return char, nil
+}
+
+func (s *fileStore) Update(ctx context.Context, id string, update UpdateFunc) (Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.mem.Get(ctx, id)
+	if err != nil {
+		return Character{}, err
+	}
+
+	char, err := update(current)
+	if err != nil {
+		return Character{}, err
+	}
+
+	// As in Create, there's no need to lock. Only check new names, so
+	// that characters that had the same one before names were unique
+	// can still be changed.
+	if nameKey(char.Name) != nameKey(current.Name) {
+		if err := s.mem.checkName(char.Name, id); err != nil {
+			return Character{}, err
+		}
+	}
+
+	// Ensure that ID and owner aren't replaced.
+	char.ID = id
+	char.Owner = current.Owner
+	char.Version = current.Version + 1
+	if err := s.write(putRecord(newRevision(ctx, char))); err != nil {
+		return Character{}, err
+	}
+
+	return char, nil
+}
+
+func (s *fileStore) Delete(ctx context.Context, id string, check CheckFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.mem.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if check != nil {
+		if err := check(current); err != nil {
+			return err
+		}
+	}
+
+	return s.write(deleteRecord(ctx, id))
+}
+
+func (s *fileStore) Apply(ctx context.Context, ops []Operation) ([]Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Try the operations first, to know what to write, then undo them
+	// since the write replays them. Readers mustn't see them meanwhile.
+	s.mem.mu.Lock()
+	results, undo, err := s.mem.apply(ctx, ops)
+	if err == nil {
+		undo()
+	}
+	s.mem.mu.Unlock()
+
+	if err != nil || len(ops) == 0 {
+		return results, err
+	}
+
+	batch := logRecord{Op: recordBatch, Author: authorOf(ctx), Time: time.Now().UTC()}
+	for idx, op := range ops {
+		if op.Op == opDelete {
+			batch.Records = append(batch.Records, deleteRecord(ctx, op.ID))
+			continue
+		}
+
+		batch.Records = append(batch.Records, putRecord(newRevision(ctx, results[idx])))
+	}
+
+	if err := s.write(batch); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (s *fileStore) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	return s.mem.Revisions(ctx, id)
+}
+
+func (s *fileStore) Quotas(ctx context.Context) ([]Quota, error) {
+	return s.mem.Quotas(ctx)
+}
+
+func (s *fileStore) Quota(ctx context.Context, account string) (Quota, error) {
+	return s.mem.Quota(ctx, account)
+}
+
+func (s *fileStore) SetQuota(ctx context.Context, account string, remaining int) (Quota, error) {
+	if remaining < 0 {
+		return Quota{}, ErrQuotaTooLow
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.write(quotaRecord(ctx, account, &remaining)); err != nil {
+		return Quota{}, err
+	}
+
+	return Quota{Account: account, Remaining: remaining}, nil
+}
+
+func (s *fileStore) AdjustQuota(ctx context.Context, account string, delta int) (Quota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quota, err := s.mem.adjustedQuota(account, delta)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	if err := s.write(quotaRecord(ctx, account, &quota.Remaining)); err != nil {
+		return Quota{}, err
+	}
+
+	return quota, nil
+}
+
+func (s *fileStore) RemoveQuota(ctx context.Context, account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.mem.quotas[account]; !ok {
+		return ErrQuotaNotFound
+	}
+
+	return s.write(quotaRecord(ctx, account, nil))
+}
+
+// Close closes the log. The store can't be used afterwards.
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// write appends the record to the log, syncs it and only then
+// applies it in memory. The caller must hold s.mu.
+func (s *fileStore) write(record logRecord) error {
+	if s.broken != nil {
+		return fmt.Errorf("write: the log is broken: %v", s.broken)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+	if _, err := s.file.Write(line); err != nil {
+		// Cut off whatever part of the line was written, so that the
+		// next records don't end up behind a broken one.
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+
+	s.size += int64(len(line))
+
+	if err := s.replay(record); err != nil {
+		return err
+	}
+
+	s.records += record.changes()
+
+	// Don't bother compacting a log that's mostly revisions and quotas
+	// that are kept, since it wouldn't get much smaller. Only writes
+	// change them, and we're holding s.mu, so there's no need to lock.
+	if s.records >= compactAfter && s.records > 2*(s.mem.revisionCount+len(s.mem.quotas)+len(s.mem.unlimited)) {
+		// The change is already durable, so a failed compaction
+		// only means that the log stays long.
+		s.compact()
+	}
+
+	return nil
+}
+
+// compact replaces the log with one holding a record per revision
+// and quota that's kept. The caller must hold s.mu, unless the store
+// is being opened.
+func (s *fileStore) compact() error {
+	var records []logRecord
+	s.mem.mu.RLock()
+	for _, rev := range s.mem.revisions() {
+		records = append(records, putRecord(rev))
+	}
+
+	// The quotas come last, since replaying the characters uses them
+	// up again.
+	for _, quota := range s.mem.quotaList() {
+		remaining := quota.Remaining
+		records = append(records, logRecord{Op: recordQuota, Account: quota.Account, Remaining: &remaining})
+	}
+
+	unlimited := make([]string, 0, len(s.mem.unlimited))
+	for account := range s.mem.unlimited {
+		unlimited = append(unlimited, account)
+	}
+	sort.Strings(unlimited)
+	for _, account := range unlimited {
+		records = append(records, logRecord{Op: recordQuota, Account: account})
+	}
+	s.mem.mu.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// This fails once the rename went through, which is fine.
+	defer os.Remove(tmp.Name())
+
+	size, err := writeRecords(tmp, records)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Open the new log before it replaces the old one, so that nothing
+	// can fail between the rename and switching over to it.
+	file, err := os.OpenFile(tmp.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		file.Close()
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	s.file = file
+	s.records = len(records)
+	s.size = size
+
+	// Make the rename itself durable. Until it is, a crash could bring
+	// the old log back, without what's appended to the new one.
+	if err := s.syncDir(filepath.Dir(s.path)); err != nil {
+		s.broken = err
+		return err
+	}
+
+	return nil
+}
+
+// writeRecords writes the records and returns the number of bytes
+// written.
+func writeRecords(w io.Writer, records []logRecord) (int64, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return 0, err
+		}
+	}
+
+	return buf.WriteTo(w)
+}
+
+// syncPath syncs the file or directory at path.
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reopen closes the store and opens its log again.
+func reopen(t *testing.T, store *fileStore) *fileStore {
+	t.Helper()
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openFileStore(store.path)
+	if err != nil {
+		t.Fatalf(`openFileStore(%q) returned %v`, store.path, err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestFileStoreSeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "characters.jsonl")
+
+	store, err := openFileStore(path, seedCharacters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = reopen(t, store)
+	list, _ := store.List(context.Background())
+	if len(list) != len(seedCharacters) || list[0] != seedCharacters[0] {
+		t.Fatalf(`List after reopening = %+v, want the seed characters`, list)
+	}
+}
+
+func TestFileStoreRecover(t *testing.T) {
+	ctx := context.Background()
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hades, _ := store.Create(ctx, Character{Name: "Hades", Role: "Emet-Selch", Level: 99})
+	venat, _ := store.Create(ctx, Character{Name: "Venat", Role: "Former Azem", Level: 99})
+	hades.Level = 100
+	hades, _ = store.Update(ctx, hades.ID, replaceWith(hades))
+	store.Delete(ctx, venat.ID, nil)
+
+	store = reopen(t, store)
+
+	got, err := store.Get(ctx, hades.ID)
+	if got != hades || err != nil {
+		t.Fatalf(`Get(%q) after reopening = %+v, %v, want %+v, nil`, hades.ID, got, err, hades)
+	}
+
+	if _, err := store.Get(ctx, venat.ID); !errors.Is(err, ErrCharacterNotFound) {
+		t.Fatalf(`Get(%q) after reopening returned %v, want ErrCharacterNotFound`, venat.ID, err)
+	}
+}
+
+func TestFileStoreTornWrite(t *testing.T) {
+	ctx := context.Background()
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hades, _ := store.Create(ctx, Character{Name: "Hades", Role: "Emet-Selch", Level: 99})
+	store.Close()
+
+	// Simulate a crash halfway through appending a record.
+	f, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"put","character":{"id":"x","na`)
+	f.Close()
+
+	store, err = openFileStore(store.path)
+	if err != nil {
+		t.Fatalf(`openFileStore after a torn write returned %v`, err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// The next records must not end up behind the broken one.
+	venat, _ := store.Create(ctx, Character{Name: "Venat", Role: "Former Azem", Level: 99})
+	store = reopen(t, store)
+
+	list, _ := store.List(ctx)
+	if len(list) != 2 || list[0] != hades || list[1] != venat {
+		t.Fatalf(`List = %+v, want Hades and Venat`, list)
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "characters.jsonl")
+	os.WriteFile(path, []byte("not json\n{\"op\":\"delete\",\"id\":\"x\"}\n"), 0o600)
+
+	if _, err := openFileStore(path); err == nil || !strings.Contains(err.Error(), "record 1") {
+		t.Fatalf(`openFileStore of a corrupt log returned %v, want an error about record 1`, err)
+	}
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	ctx := context.Background()
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	char, _ := store.Create(ctx, Character{Name: "Hythlodaeus", Level: 0})
+	for level := 1; level <= compactAfter; level++ {
+		char.Level = level
+		var err error
+		if char, err = store.Update(ctx, char.ID, replaceWith(char)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(content), "\n"); lines >= compactAfter {
+		t.Fatalf(`The log has %d records after %d updates, want it compacted`, lines, compactAfter)
+	}
+
+	matches, _ := filepath.Glob(store.path + ".*.tmp")
+	if len(matches) > 0 {
+		t.Fatalf(`Compaction left %v behind`, matches)
+	}
+
+	revisions, _ := store.Revisions(ctx, char.ID)
+
+	store = reopen(t, store)
+	if got, err := store.Get(ctx, char.ID); got != char || err != nil {
+		t.Fatalf(`Get(%q) after compacting = %+v, %v, want %+v, nil`, char.ID, got, err, char)
+	}
+
+	got, _ := store.Revisions(ctx, char.ID)
+	if !reflect.DeepEqual(got, revisions) {
+		t.Fatalf(`Revisions(%q) after compacting = %d revisions, want the %d from before`, char.ID, len(got), len(revisions))
+	}
+}
+
+func TestFileStoreFailedCompaction(t *testing.T) {
+	ctx := context.Background()
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	themis, _ := store.Create(ctx, Character{Name: "Themis", Level: 99})
+
+	// Fail once the new log has replaced the old one.
+	store.syncDir = func(string) error { return errors.New("disk on fire") }
+	if err := store.compact(); err == nil {
+		t.Fatalf(`compact with a failing sync returned no error`)
+	}
+
+	if _, err := store.Create(ctx, Character{Name: "Lyse", Level: 70}); err == nil {
+		t.Fatalf(`Create after a failed compaction returned no error, want the store broken`)
+	}
+
+	store = reopen(t, store)
+	list, _ := store.List(ctx)
+	if len(list) != 1 || list[0] != themis {
+		t.Fatalf(`List after a failed compaction = %+v, want only Themis`, list)
+	}
+}
+
+func TestFileStoreRevisions(t *testing.T) {
+	ctx := withAuthor(context.Background(), "urianger")
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	char, _ := store.Create(ctx, Character{Name: "Urianger", Role: "Scion", Level: 80})
+	char.Role = "Astrologian"
+	store.Update(ctx, char.ID, replaceWith(char))
+	revisions, _ := store.Revisions(ctx, char.ID)
+
+	store = reopen(t, store)
+	if got, err := store.Revisions(ctx, char.ID); !reflect.DeepEqual(got, revisions) || err != nil {
+		t.Fatalf(`Revisions(%q) after reopening = %+v, %v, want %+v, nil`, char.ID, got, err, revisions)
+	}
+}
+
+func TestFileStoreUnversionedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "characters.jsonl")
+	os.WriteFile(path, []byte(`{"op":"put","character":{"id":"x","name":"Lyse","level":70}}
+{"op":"put","character":{"id":"x","name":"Lyse","level":71}}
+`), 0o600)
+
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	revisions, _ := store.Revisions(context.Background(), "x")
+	if len(revisions) != 2 || revisions[0].Character.Version != 1 || revisions[1].Character.Version != 2 {
+		t.Fatalf(`Revisions of a log without versions = %+v, want versions 1 and 2`, revisions)
+	}
+}
+
+func TestFileStoreApply(t *testing.T) {
+	ctx := context.Background()
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hades, _ := store.Create(ctx, Character{Name: "Hades", Role: "Emet-Selch", Level: 99})
+	results, err := store.Apply(ctx, []Operation{
+		{Op: opCreate, Character: Character{Name: "Venat", Role: "Former Azem", Level: 99}},
+		{Op: opDelete, ID: hades.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(store.path)
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Fatalf(`The log has %d records after Create and Apply, want 2`, lines)
+	}
+
+	store = reopen(t, store)
+	list, _ := store.List(ctx)
+	if len(list) != 1 || list[0] != results[0] {
+		t.Fatalf(`List after reopening = %+v, want only %+v`, list, results[0])
+	}
+}
+
+func TestFileStoreQuotas(t *testing.T) {
+	ctx := context.Background()
+	store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.SetQuota(ctx, "alisaie", 2)
+	store.SetQuota(ctx, "alphinaud", 5)
+	store.RemoveQuota(ctx, "alphinaud")
+	store.Create(ctx, Character{Name: "Alisaie", Level: 80, Owner: "alisaie"})
+
+	want := []Quota{{Account: "alisaie", Remaining: 1}}
+	store = reopen(t, store)
+	if got, _ := store.Quotas(ctx); !reflect.DeepEqual(got, want) {
+		t.Fatalf(`Quotas after reopening = %+v, want %+v`, got, want)
+	}
+
+	if err := store.compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = reopen(t, store)
+	if got, _ := store.Quotas(ctx); !reflect.DeepEqual(got, want) {
+		t.Fatalf(`Quotas after compacting = %+v, want %+v`, got, want)
+	}
+
+	// Removing a quota must outlive compacting too.
+	if quota, _ := store.Quota(ctx, "alphinaud"); !quota.Unlimited || quota.Default {
+		t.Fatalf(`Quota("alphinaud") after compacting = %+v, want unlimited`, quota)
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore keeps the characters in a slice, guarded by a mutex.
+type memoryStore struct {
+	mu         sync.RWMutex
+	characters []Character
+	// history holds the revisions of each character, oldest first.
+	history map[string][]Revision
+	// revisionCount is the number of revisions in history, kept up to
+	// date so that the file store can afford to check it on each write.
+	revisionCount int
+	// quotas holds the characters remaining of the accounts that have
+	// a quota. The others can create as many as they like.
+	quotas map[string]int
+	// unlimited holds the accounts whose quota was removed, to tell
+	// them apart from the ones that never had one.
+	unlimited map[string]bool
+	// names counts the characters by the key of their name, so that
+	// checking that a name is free doesn't fold every other name. It's
+	// a count since characters from before names were unique may share
+	// one.
+	names map[string]int
+}
+
+// newMemoryStore returns a store holding the given characters, each
+// with a single revision.
+func newMemoryStore(characters ...Character) *memoryStore {
+	s := &memoryStore{history: make(map[string][]Revision), quotas: make(map[string]int), unlimited: make(map[string]bool), names: make(map[string]int)}
+	for _, char := range characters {
+		s.put(newRevision(context.Background(), char))
+	}
+
+	return s
+}
+
+func (s *memoryStore) List(ctx context.Context) ([]Character, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Return a copy, since the slice changes after we unlock.
+	return append([]Character{}, s.characters...), nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id string) (Character, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.indexOf(id)
+	if idx == -1 {
+		return Character{}, ErrCharacterNotFound
+	}
+
+	return s.characters[idx], nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, char Character) (Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.create(ctx, char)
+}
+
+// create is Create. The caller must hold the lock.
+func (s *memoryStore) create(ctx context.Context, char Character) (Character, error) {
+	if quota := s.quotaOf(char.Owner); !quota.Unlimited && quota.Remaining <= 0 {
+		return Character{}, fmt.Errorf("Create: %w for %s", ErrNoCharactersRemaining, char.Owner)
+	}
+
+	if err := s.checkName(char.Name, ""); err != nil {
+		return Character{}, err
+	}
+
+	char.ID = uuid.New().String()
+	char.Version = 1
+	s.characters = append(s.characters, char)
+	s.countName(char.Name, 1)
+	s.addRevision(newRevision(ctx, char))
+	s.charge(char.Owner, 1)
+
+	return char, nil
+}
+
+// put stores the character of the revision as is, replacing the one
+// with the same ID if there's one. It's how other stores replay their
+// changes.
+func (s *memoryStore) put(rev Revision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addRevision(rev)
+
+	char := rev.Character
+	if idx := s.indexOf(char.ID); idx != -1 {
+		s.countName(s.characters[idx].Name, -1)
+		s.countName(char.Name, 1)
+		s.characters[idx] = char
+		return
+	}
+
+	s.characters = append(s.characters, char)
+	s.countName(char.Name, 1)
+	s.charge(char.Owner, 1)
+}
+
+// remove deletes the character with the given ID, if there's one.
+func (s *memoryStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if idx := s.indexOf(id); idx != -1 {
+		s.charge(s.characters[idx].Owner, -1)
+		s.countName(s.characters[idx].Name, -1)
+		s.characters = append(s.characters[:idx], s.characters[idx+1:]...)
+	}
+
+	s.setHistory(id, nil)
+}
+
+// setQuota sets the quota of the account, or removes it if remaining
+// is nil. It's how other stores replay their changes.
+func (s *memoryStore) setQuota(account string, remaining *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if remaining == nil {
+		delete(s.quotas, account)
+		s.unlimited[account] = true
+		return
+	}
+
+	s.quotas[account] = *remaining
+	delete(s.unlimited, account)
+}
+
+func (s *memoryStore) Update(ctx context.Context, id string, update UpdateFunc) (Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(ctx, id, update)
+}
+
+// update is Update. The caller must hold the lock.
+func (s *memoryStore) update(ctx context.Context, id string, update UpdateFunc) (Character, error) {
+	idx := s.indexOf(id)
+	if idx == -1 {
+		return Character{}, ErrCharacterNotFound
+	}
+
+	current := s.characters[idx]
+	char, err := update(current)
+	if err != nil {
+		return Character{}, err
+	}
+
+	// Only check new names, so that characters that had the same
+	// one before names were unique can still be changed.
+	if nameKey(char.Name) != nameKey(current.Name) {
+		if err := s.checkName(char.Name, id); err != nil {
+			return Character{}, err
+		}
+	}
+
+	// Ensure that ID and owner aren't replaced.
+	char.ID = id
+	char.Owner = current.Owner
+	char.Version = current.Version + 1
+	s.countName(current.Name, -1)
+	s.countName(char.Name, 1)
+	s.characters[idx] = char
+	s.addRevision(newRevision(ctx, char))
+
+	return char, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id string, check CheckFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(id, check)
+}
+
+// delete is Delete. The caller must hold the lock.
+func (s *memoryStore) delete(id string, check CheckFunc) error {
+	idx := s.indexOf(id)
+	if idx == -1 {
+		return ErrCharacterNotFound
+	}
+
+	if check != nil {
+		if err := check(s.characters[idx]); err != nil {
+			return err
+		}
+	}
+
+	s.charge(s.characters[idx].Owner, -1)
+	s.countName(s.characters[idx].Name, -1)
+	s.characters = append(s.characters[:idx], s.characters[idx+1:]...)
+	s.setHistory(id, nil)
+	return nil
+}
+
+func (s *memoryStore) Apply(ctx context.Context, ops []Operation) ([]Character, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results, _, err := s.apply(ctx, ops)
+	return results, err
+}
+
+// apply is Apply, which also returns how to undo the operations. If one
+// of them fails, it undoes the others itself. The caller must hold the
+// lock.
+func (s *memoryStore) apply(ctx context.Context, ops []Operation) ([]Character, func(), error) {
+	// Keep how to undo each operation rather than a copy of the store,
+	// so that small batches stay cheap.
+	var undos []func()
+	undo := func() {
+		for idx := len(undos) - 1; idx >= 0; idx-- {
+			undos[idx]()
+		}
+	}
+
+	results := make([]Character, len(ops))
+	for idx, op := range ops {
+		// Operations that fail don't change anything.
+		var err error
+		switch op.Op {
+		case opCreate:
+			if results[idx], err = s.create(ctx, op.Character); err == nil {
+				undos = append(undos, s.undoCreate(results[idx].ID))
+			}
+		case opUpdate:
+			revert := s.undoChange(op.ID)
+			if results[idx], err = s.update(ctx, op.ID, op.Update); err == nil {
+				undos = append(undos, revert)
+			}
+		case opDelete:
+			revert := s.undoChange(op.ID)
+			if err = s.delete(op.ID, op.Check); err == nil {
+				undos = append(undos, revert)
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+
+		if err != nil {
+			undo()
+			return nil, nil, &OperationError{Index: idx, Err: err}
+		}
+	}
+
+	return results, undo, nil
+}
+
+// undoCreate returns how to undo the creation of the character with
+// the given ID, which create appended. Later changes must be undone
+// first. The caller must hold the lock.
+func (s *memoryStore) undoCreate(id string) func() {
+	return func() {
+		last := len(s.characters) - 1
+		s.charge(s.characters[last].Owner, -1)
+		s.countName(s.characters[last].Name, -1)
+		s.characters = s.characters[:last]
+		s.setHistory(id, nil)
+	}
+}
+
+// undoChange returns how to put the character with the given ID, and
+// its history, back as they are now, once it's updated or deleted.
+// Later changes must be undone first. The caller must hold the lock.
+func (s *memoryStore) undoChange(id string) func() {
+	idx := s.indexOf(id)
+	if idx == -1 {
+		// The operation will fail.
+		return nil
+	}
+
+	char, history := s.characters[idx], s.history[id]
+	return func() {
+		if s.indexOf(id) == -1 {
+			s.characters = append(s.characters, Character{})
+			copy(s.characters[idx+1:], s.characters[idx:])
+			s.charge(char.Owner, 1)
+		} else {
+			s.countName(s.characters[idx].Name, -1)
+		}
+
+		// addRevision only appends beyond the end of history, so
+		// it's still as it was.
+		s.countName(char.Name, 1)
+		s.characters[idx] = char
+		s.setHistory(id, history)
+	}
+}
+
+func (s *memoryStore) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.indexOf(id) == -1 {
+		return nil, ErrCharacterNotFound
+	}
+
+	// Return a copy, since addRevision reuses the slice.
+	return append([]Revision{}, s.history[id]...), nil
+}
+
+func (s *memoryStore) Quotas(ctx context.Context) ([]Quota, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.quotaList(), nil
+}
+
+func (s *memoryStore) Quota(ctx context.Context, account string) (Quota, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.quotaOf(account), nil
+}
+
+// quotaOf returns the quota of the account. The default is no limit.
+// The caller must hold the lock.
+func (s *memoryStore) quotaOf(account string) Quota {
+	if remaining, ok := s.quotas[account]; ok {
+		return Quota{Account: account, Remaining: remaining}
+	}
+
+	return Quota{Account: account, Unlimited: true, Default: !s.unlimited[account]}
+}
+
+func (s *memoryStore) SetQuota(ctx context.Context, account string, remaining int) (Quota, error) {
+	if remaining < 0 {
+		return Quota{}, ErrQuotaTooLow
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quotas[account] = remaining
+	delete(s.unlimited, account)
+	return Quota{Account: account, Remaining: remaining}, nil
+}
+
+func (s *memoryStore) AdjustQuota(ctx context.Context, account string, delta int) (Quota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quota, err := s.adjustedQuota(account, delta)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	s.quotas[account] = quota.Remaining
+	return quota, nil
+}
+
+// adjustedQuota returns what the quota of the account would be once
+// adjusted by delta. The caller must hold the lock.
+func (s *memoryStore) adjustedQuota(account string, delta int) (Quota, error) {
+	remaining, ok := s.quotas[account]
+	if !ok {
+		return Quota{}, ErrQuotaNotFound
+	}
+
+	if remaining+delta < 0 {
+		return Quota{}, ErrQuotaTooLow
+	}
+
+	return Quota{Account: account, Remaining: remaining + delta}, nil
+}
+
+func (s *memoryStore) RemoveQuota(ctx context.Context, account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.quotas[account]; !ok {
+		return ErrQuotaNotFound
+	}
+
+	delete(s.quotas, account)
+	s.unlimited[account] = true
+	return nil
+}
+
+// charge uses up n of the characters remaining of the account, if it
+// has a quota. A negative n gives them back. The caller must hold the
+// lock.
+func (s *memoryStore) charge(account string, n int) {
+	if remaining, ok := s.quotas[account]; ok {
+		s.quotas[account] = remaining - n
+	}
+}
+
+// quotaList returns the quotas, by account name. The caller must hold
+// the lock.
+func (s *memoryStore) quotaList() []Quota {
+	quotas := []Quota{}
+	for account, remaining := range s.quotas {
+		quotas = append(quotas, Quota{Account: account, Remaining: remaining})
+	}
+
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Account < quotas[j].Account })
+	return quotas
+}
+
+// addRevision appends rev to the history of its character, dropping
+// the oldest revision beyond maxRevisions. The caller must hold the
+// lock.
+func (s *memoryStore) addRevision(rev Revision) {
+	id := rev.Character.ID
+	revisions := append(s.history[id], rev)
+	if len(revisions) > maxRevisions {
+		revisions = revisions[len(revisions)-maxRevisions:]
+	}
+
+	s.setHistory(id, revisions)
+}
+
+// setHistory replaces the revisions of the character with the given
+// ID, or forgets them if there are none. The caller must hold the lock.
+func (s *memoryStore) setHistory(id string, revisions []Revision) {
+	s.revisionCount += len(revisions) - len(s.history[id])
+	if len(revisions) == 0 {
+		delete(s.history, id)
+		return
+	}
+
+	s.history[id] = revisions
+}
+
+// revisions returns the revisions of every character, in the order of
+// the characters. The caller must hold the lock.
+func (s *memoryStore) revisions() []Revision {
+	var revisions []Revision
+	for _, char := range s.characters {
+		revisions = append(revisions, s.history[char.ID]...)
+	}
+
+	return revisions
+}
+
+// checkName returns a *NameTakenError if a character other than the
+// one with the given ID has the name. The caller must hold the lock.
+func (s *memoryStore) checkName(name, id string) error {
+	key := nameKey(name)
+	if s.names[key] == 0 {
+		return nil
+	}
+
+	// The name is taken, which is rare enough to look for by who.
+	for _, char := range s.characters {
+		if char.ID != id && nameKey(char.Name) == key {
+			return &NameTakenError{Name: name, ID: char.ID}
+		}
+	}
+
+	return nil
+}
+
+// countName adds n to the number of characters with the name. The
+// caller must hold the lock.
+func (s *memoryStore) countName(name string, n int) {
+	key := nameKey(name)
+	if s.names[key] += n; s.names[key] <= 0 {
+		delete(s.names, key)
+	}
+}
+
+// indexOf returns the position of the character with the given ID,
+// or -1. The caller must hold the lock.
+func (s *memoryStore) indexOf(id string) int {
+	for idx, char := range s.characters {
+		if char.ID == id {
+			return idx
+		}
+	}
+
+	return -1
+}
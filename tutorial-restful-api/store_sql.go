@@ -0,0 +1,608 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// sqlStore keeps the characters in the characters table from
+// tutorial-relational-db's create-tables.sql. Each character created
+// uses up one of its owner's characters_remaining in the accounts
+// table, and deleting one gives it back, as addCharacter and
+// deleteCharacter do there. Accounts that aren't in the table can't
+// create characters, while those whose characters_remaining is NULL
+// have no limit.
+//
+// Names are unique by their name_key column, which holds their
+// nameKey.
+//
+// The revisions go to the character_revisions table, in the same
+// transaction as the change.
+//
+// The database uses integer IDs, which the API exposes as strings.
+// Only `?` placeholders are used, so that both MySQL and SQLite work.
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+	// account owns the characters created without an owner.
+	account string
+}
+
+// The SQL dialects that sqlStore speaks.
+const (
+	dialectMySQL = "mysql"
+	// SQLite has no `SELECT ... FOR UPDATE`. Open the database with
+	// `_txlock=immediate` instead, so that transactions take the
+	// write lock right away.
+	dialectSQLite = "sqlite3"
+)
+
+// newSQLStore returns a store backed by db, where the characters
+// created without an owner belong to the given account.
+func newSQLStore(db *sql.DB, dialect, account string) *sqlStore {
+	return &sqlStore{db: db, dialect: dialect, account: account}
+}
+
+// characterColumns are the columns that scanCharacter reads.
+const characterColumns = "id, name, role, level, version, owner"
+
+func (s *sqlStore) List(ctx context.Context) ([]Character, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+characterColumns+" FROM characters ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("List: %v", err)
+	}
+	defer rows.Close()
+
+	// Marshal an empty list as [], like the other stores do.
+	characters := []Character{}
+	for rows.Next() {
+		char, err := scanCharacter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("List: %v", err)
+		}
+
+		characters = append(characters, char)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("List: %v", err)
+	}
+
+	return characters, nil
+}
+
+func (s *sqlStore) Get(ctx context.Context, id string) (Character, error) {
+	return getCharacter(ctx, s.db, id)
+}
+
+func (s *sqlStore) Create(ctx context.Context, char Character) (Character, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	}
+	defer tx.Rollback()
+
+	if char, err = s.create(ctx, tx, char); err != nil {
+		return Character{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	}
+
+	return char, nil
+}
+
+// create is Create, inside tx.
+func (s *sqlStore) create(ctx context.Context, tx *sql.Tx, char Character) (Character, error) {
+	if char.Owner == "" {
+		char.Owner = s.account
+	}
+
+	// Check and use up the quota in one statement, so that two
+	// concurrent requests can't both take the last character.
+	result, err := tx.ExecContext(ctx,
+		"UPDATE accounts SET characters_remaining=characters_remaining-1 WHERE name=? AND (characters_remaining>0 OR characters_remaining IS NULL)",
+		char.Owner)
+	if err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	} else if affected == 0 {
+		return Character{}, fmt.Errorf("Create: %w for %s", ErrNoCharactersRemaining, char.Owner)
+	}
+
+	if err := s.checkName(ctx, tx, char.Name, 0); err != nil {
+		return Character{}, err
+	}
+
+	char.Version = 1
+	result, err = tx.ExecContext(ctx, "INSERT INTO characters (name, name_key, role, level, version, owner) VALUES (?, ?, ?, ?, ?, ?)", char.Name, nameKey(char.Name), char.Role, char.Level, char.Version, char.Owner)
+	if err := s.nameTaken(ctx, tx, char.Name, err); err != nil {
+		return Character{}, err
+	}
+
+	if err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	}
+
+	char.ID = strconv.FormatInt(id, 10)
+	if err := addRevision(ctx, tx, id, newRevision(ctx, char)); err != nil {
+		return Character{}, fmt.Errorf("Create: %v", err)
+	}
+
+	return char, nil
+}
+
+func (s *sqlStore) Update(ctx context.Context, id string, update UpdateFunc) (Character, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Character{}, fmt.Errorf("Update: %v", err)
+	}
+	defer tx.Rollback()
+
+	char, err := s.update(ctx, tx, id, update)
+	if err != nil {
+		return Character{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Character{}, fmt.Errorf("Update: %v", err)
+	}
+
+	return char, nil
+}
+
+// update is Update, inside tx.
+func (s *sqlStore) update(ctx context.Context, tx *sql.Tx, id string, update UpdateFunc) (Character, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Character{}, ErrCharacterNotFound
+	}
+
+	current, err := s.lockCharacter(ctx, tx, intID)
+	if err != nil {
+		return Character{}, err
+	}
+
+	char, err := update(current)
+	if err != nil {
+		return Character{}, err
+	}
+
+	// Ensure that ID and owner aren't replaced.
+	char.ID = id
+	char.Owner = current.Owner
+	char.Version = current.Version + 1
+
+	// Only check new names, as the other stores do.
+	if nameKey(char.Name) != nameKey(current.Name) {
+		if err := s.checkName(ctx, tx, char.Name, intID); err != nil {
+			return Character{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE characters SET name=?, name_key=?, role=?, level=?, version=? WHERE id=?", char.Name, nameKey(char.Name), char.Role, char.Level, char.Version, intID)
+	if err := s.nameTaken(ctx, tx, char.Name, err); err != nil {
+		return Character{}, err
+	}
+
+	if err != nil {
+		return Character{}, fmt.Errorf("Update: %v", err)
+	}
+
+	if err := addRevision(ctx, tx, intID, newRevision(ctx, char)); err != nil {
+		return Character{}, fmt.Errorf("Update: %v", err)
+	}
+
+	return char, nil
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id string, check CheckFunc) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Delete: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.delete(ctx, tx, id, check); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Delete: %v", err)
+	}
+
+	return nil
+}
+
+// delete is Delete, inside tx.
+func (s *sqlStore) delete(ctx context.Context, tx *sql.Tx, id string, check CheckFunc) error {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrCharacterNotFound
+	}
+
+	current, err := s.lockCharacter(ctx, tx, intID)
+	if err != nil {
+		return err
+	}
+
+	if check != nil {
+		if err := check(current); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM characters WHERE id=?", intID); err != nil {
+		return fmt.Errorf("Delete: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM character_revisions WHERE character_id=?", intID); err != nil {
+		return fmt.Errorf("Delete: %v", err)
+	}
+
+	// Give the character back to its owner. NULL stays NULL.
+	_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=characters_remaining+1 WHERE name=?", current.Owner)
+	if err != nil {
+		return fmt.Errorf("Delete: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Apply(ctx context.Context, ops []Operation) ([]Character, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Apply: %v", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]Character, len(ops))
+	for idx, op := range ops {
+		var err error
+		switch op.Op {
+		case opCreate:
+			results[idx], err = s.create(ctx, tx, op.Character)
+		case opUpdate:
+			results[idx], err = s.update(ctx, tx, op.ID, op.Update)
+		case opDelete:
+			err = s.delete(ctx, tx, op.ID, op.Check)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+
+		if err != nil {
+			return nil, &OperationError{Index: idx, Err: err}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Apply: %v", err)
+	}
+
+	return results, nil
+}
+
+func (s *sqlStore) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	// Make sure the character exists, since characters created before
+	// there were revisions have none.
+	current, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get made sure that the ID is an integer.
+	intID, _ := strconv.ParseInt(id, 10, 64)
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT version, name, role, level, author, changed_at FROM character_revisions WHERE character_id=? ORDER BY version",
+		intID)
+	if err != nil {
+		return nil, fmt.Errorf("Revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		// The owner never changes, so it isn't kept with the revisions.
+		rev := Revision{Character: Character{ID: id, Owner: current.Owner}}
+		char := &rev.Character
+		if err := rows.Scan(&char.Version, &char.Name, &char.Role, &char.Level, &rev.Author, &rev.Time); err != nil {
+			return nil, fmt.Errorf("Revisions: %v", err)
+		}
+
+		rev.Time = rev.Time.UTC()
+		revisions = append(revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Revisions: %v", err)
+	}
+
+	return revisions, nil
+}
+
+// addRevision records a revision of the character with the given ID,
+// dropping the ones beyond maxRevisions.
+func addRevision(ctx context.Context, tx *sql.Tx, id int64, rev Revision) error {
+	char := rev.Character
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO character_revisions (character_id, version, name, role, level, author, changed_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id, char.Version, char.Name, char.Role, char.Level, rev.Author, rev.Time)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM character_revisions WHERE character_id=? AND version<=?", id, char.Version-maxRevisions)
+	return err
+}
+
+func (s *sqlStore) Quota(ctx context.Context, account string) (Quota, error) {
+	var remaining sql.NullInt64
+	err := s.db.QueryRowContext(ctx, "SELECT characters_remaining FROM accounts WHERE name=?", account).Scan(&remaining)
+	switch {
+	case err == sql.ErrNoRows:
+		// Accounts that aren't in the table can't create characters.
+		return Quota{Account: account, Default: true}, nil
+	case err != nil:
+		return Quota{}, fmt.Errorf("Quota: %v", err)
+	case !remaining.Valid:
+		return Quota{Account: account, Unlimited: true}, nil
+	}
+
+	return Quota{Account: account, Remaining: int(remaining.Int64)}, nil
+}
+
+func (s *sqlStore) Quotas(ctx context.Context) ([]Quota, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, characters_remaining FROM accounts WHERE characters_remaining IS NOT NULL ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("Quotas: %v", err)
+	}
+	defer rows.Close()
+
+	quotas := []Quota{}
+	for rows.Next() {
+		var quota Quota
+		if err := rows.Scan(&quota.Account, &quota.Remaining); err != nil {
+			return nil, fmt.Errorf("Quotas: %v", err)
+		}
+
+		quotas = append(quotas, quota)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Quotas: %v", err)
+	}
+
+	return quotas, nil
+}
+
+func (s *sqlStore) SetQuota(ctx context.Context, account string, remaining int) (Quota, error) {
+	if remaining < 0 {
+		return Quota{}, ErrQuotaTooLow
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Quota{}, fmt.Errorf("SetQuota: %v", err)
+	}
+	defer tx.Rollback()
+
+	// MySQL doesn't count the rows an UPDATE leaves as they were, so
+	// look for the account first.
+	_, err = s.lockQuota(ctx, tx, account)
+	switch {
+	case err == ErrQuotaNotFound:
+		_, err = tx.ExecContext(ctx, "INSERT INTO accounts (name, characters_remaining) VALUES (?, ?)", account, remaining)
+	case err == nil:
+		_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=? WHERE name=?", remaining, account)
+	}
+
+	if err != nil {
+		return Quota{}, fmt.Errorf("SetQuota: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Quota{}, fmt.Errorf("SetQuota: %v", err)
+	}
+
+	return Quota{Account: account, Remaining: remaining}, nil
+}
+
+func (s *sqlStore) AdjustQuota(ctx context.Context, account string, delta int) (Quota, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Quota{}, fmt.Errorf("AdjustQuota: %v", err)
+	}
+	defer tx.Rollback()
+
+	quota, err := s.lockQuota(ctx, tx, account)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	if !quota.Valid {
+		return Quota{}, ErrQuotaNotFound
+	}
+
+	remaining := int(quota.Int64)
+	if remaining+delta < 0 {
+		return Quota{}, ErrQuotaTooLow
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE accounts SET characters_remaining=? WHERE name=?", remaining+delta, account)
+	if err != nil {
+		return Quota{}, fmt.Errorf("AdjustQuota: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Quota{}, fmt.Errorf("AdjustQuota: %v", err)
+	}
+
+	return Quota{Account: account, Remaining: remaining + delta}, nil
+}
+
+func (s *sqlStore) RemoveQuota(ctx context.Context, account string) error {
+	// Keep the row, which tutorial-relational-db needs.
+	result, err := s.db.ExecContext(ctx, "UPDATE accounts SET characters_remaining=NULL WHERE name=? AND characters_remaining IS NOT NULL", account)
+	if err != nil {
+		return fmt.Errorf("RemoveQuota: %v", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("RemoveQuota: %v", err)
+	} else if affected == 0 {
+		return ErrQuotaNotFound
+	}
+
+	return nil
+}
+
+// lockQuota reads the characters remaining of the account, locking
+// its row until the transaction ends. It's NULL if the account has no
+// limit, and ErrQuotaNotFound is returned if it has no row.
+func (s *sqlStore) lockQuota(ctx context.Context, tx *sql.Tx, account string) (sql.NullInt64, error) {
+	var remaining sql.NullInt64
+	err := tx.QueryRowContext(ctx, s.forUpdate("SELECT characters_remaining FROM accounts WHERE name=?"), account).Scan(&remaining)
+	if err == sql.ErrNoRows {
+		return sql.NullInt64{}, ErrQuotaNotFound
+	}
+
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("lockQuota %q: %v", account, err)
+	}
+
+	return remaining, nil
+}
+
+// forUpdate makes a SELECT lock the rows it reads, where the dialect
+// needs it.
+func (s *sqlStore) forUpdate(query string) string {
+	if s.dialect == dialectMySQL {
+		return query + " FOR UPDATE"
+	}
+
+	return query
+}
+
+// checkName returns a *NameTakenError if a character other than the
+// one with the given ID has the name. It doesn't lock anything: on
+// MySQL, that would take a gap lock when the name is free, which two
+// transactions can hold at once, and they would then deadlock on their
+// writes. The unique key on name_key settles such races: see nameTaken.
+func (s *sqlStore) checkName(ctx context.Context, tx *sql.Tx, name string, id int64) error {
+	var other int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM characters WHERE name_key=? AND id<>?", nameKey(name), id).Scan(&other)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("checkName %q: %v", name, err)
+	}
+
+	return &NameTakenError{Name: name, ID: strconv.FormatInt(other, 10)}
+}
+
+// nameTaken returns a *NameTakenError if err, from writing a character
+// with the given name, is a duplicate key: another transaction took the
+// name after checkName. Otherwise, it returns nil.
+func (s *sqlStore) nameTaken(ctx context.Context, tx *sql.Tx, name string, err error) error {
+	if err == nil || !isDuplicateKey(err) {
+		return nil
+	}
+
+	// Lock the row, so that MySQL reads it as committed rather than as
+	// of the snapshot of tx, which may not have it.
+	var other int64
+	if err := tx.QueryRowContext(ctx, s.forUpdate("SELECT id FROM characters WHERE name_key=?"), nameKey(name)).Scan(&other); err != nil {
+		return fmt.Errorf("nameTaken %q: %v", name, err)
+	}
+
+	return &NameTakenError{Name: name, ID: strconv.FormatInt(other, 10)}
+}
+
+// isDuplicateKey reports whether err is a violation of a unique key.
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	}
+
+	// Only the tests import the SQLite driver, so go by its message.
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// lockCharacter reads the character with the given ID, locking its
+// row until the transaction ends so that nothing changes it meanwhile.
+func (s *sqlStore) lockCharacter(ctx context.Context, tx *sql.Tx, id int64) (Character, error) {
+	query := s.forUpdate("SELECT " + characterColumns + " FROM characters WHERE id=?")
+	char, err := scanCharacter(tx.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return Character{}, ErrCharacterNotFound
+	}
+
+	if err != nil {
+		return Character{}, fmt.Errorf("lockCharacter %d: %v", id, err)
+	}
+
+	return char, nil
+}
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getCharacter returns the character with the given ID. IDs that
+// aren't integers can't be in the table, so they're not found.
+func getCharacter(ctx context.Context, q querier, id string) (Character, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Character{}, ErrCharacterNotFound
+	}
+
+	row := q.QueryRowContext(ctx, "SELECT "+characterColumns+" FROM characters WHERE id=?", intID)
+	char, err := scanCharacter(row)
+	if err == sql.ErrNoRows {
+		return Character{}, ErrCharacterNotFound
+	}
+
+	if err != nil {
+		return Character{}, fmt.Errorf("getCharacter %q: %v", id, err)
+	}
+
+	return char, nil
+}
+
+// scanner is what *sql.Row and *sql.Rows have in common.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCharacter reads a character from the current row, turning its
+// ID into a string.
+func scanCharacter(row scanner) (Character, error) {
+	var char Character
+	var id int64
+
+	if err := row.Scan(&id, &char.Name, &char.Role, &char.Level, &char.Version, &char.Owner); err != nil {
+		return Character{}, err
+	}
+
+	char.ID = strconv.FormatInt(id, 10)
+	return char, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// mysqlToSQLite translates the parts of create-tables.sql that only
+// MySQL understands.
+var mysqlToSQLite = strings.NewReplacer(
+	// SQLite only numbers the rows of INTEGER PRIMARY KEY columns.
+	"INT AUTO_INCREMENT NOT NULL", "INTEGER PRIMARY KEY AUTOINCREMENT",
+	// SQLite compares text byte by byte anyway.
+	"CHARACTER SET utf8mb4 COLLATE utf8mb4_bin ", "",
+	"UNIQUE KEY", "UNIQUE",
+	// go-sqlite3 only reads DATETIME columns as times.
+	"DATETIME(6)", "DATETIME",
+)
+
+// idPrimaryKey is the PRIMARY KEY clause that the translated id
+// columns make redundant.
+var idPrimaryKey = regexp.MustCompile("(?m)^\\s*PRIMARY KEY \\(`id`\\),\\n")
+
+// sqliteSchema returns the tables of create-tables.sql from
+// tutorial-relational-db, which tutorial-restful-api uses in
+// production, translated to SQLite and without the sample rows.
+func sqliteSchema(t *testing.T) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("..", "tutorial-relational-db", "create-tables.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := idPrimaryKey.ReplaceAllString(mysqlToSQLite.Replace(string(content)), "")
+
+	var statements []string
+	for _, statement := range strings.Split(schema, ";") {
+		// Statements may start with comments.
+		code := statement
+		for strings.HasPrefix(strings.TrimSpace(code), "--") {
+			code = strings.SplitN(strings.TrimSpace(code), "\n", 2)[1]
+		}
+
+		if code = strings.TrimSpace(code); strings.HasPrefix(code, "CREATE") || strings.HasPrefix(code, "DROP") {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
+
+func init() {
+	storeFactories["sql"] = func(t *testing.T) CharacterStore {
+		return newSQLStore(openSQLite(t, 1000), dialectSQLite, "admin")
+	}
+}
+
+// openSQLite returns a database with the schema, where the admin
+// account has the given number of characters remaining.
+func openSQLite(t *testing.T, remaining int) *sql.DB {
+	t.Helper()
+	return openSQLiteAt(t, filepath.Join(t.TempDir(), "characters.db"), remaining)
+}
+
+// openSQLiteAt opens the database at path, creating it with an admin
+// account unless remaining is negative.
+func openSQLiteAt(t *testing.T, path string, remaining int) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_txlock=immediate", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// SQLite only allows a single writer anyway.
+	db.SetMaxOpenConns(1)
+
+	if remaining < 0 {
+		return db
+	}
+
+	for _, statement := range sqliteSchema(t) {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf(`%s: %v`, statement, err)
+		}
+	}
+
+	if _, err := db.Exec("INSERT INTO accounts (name, characters_remaining) VALUES (?, ?)", "admin", remaining); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func remaining(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow("SELECT characters_remaining FROM accounts WHERE name=?", "admin").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestSQLStoreQuota(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, 1)
+	store := newSQLStore(db, dialectSQLite, "admin")
+
+	themis, err := store.Create(ctx, Character{Name: "Themis", Role: "Elidibus", Level: 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := remaining(t, db); n != 0 {
+		t.Fatalf(`characters_remaining after Create = %d, want 0`, n)
+	}
+
+	if _, err := store.Create(ctx, Character{Name: "Lyse", Role: "Ala Mhigan Resistance", Level: 70}); !errors.Is(err, ErrNoCharactersRemaining) {
+		t.Fatalf(`Create over the quota returned %v, want ErrNoCharactersRemaining`, err)
+	}
+
+	// The rejected character must not have been inserted.
+	if list, _ := store.List(ctx); len(list) != 1 {
+		t.Fatalf(`List = %+v, want only Themis`, list)
+	}
+
+	if err := store.Delete(ctx, themis.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := remaining(t, db); n != 1 {
+		t.Fatalf(`characters_remaining after Delete = %d, want 1`, n)
+	}
+}
+
+func TestSQLStoreUnknownAccount(t *testing.T) {
+	store := newSQLStore(openSQLite(t, 1), dialectSQLite, "nobody")
+
+	if _, err := store.Create(context.Background(), Character{Name: "Themis"}); !errors.Is(err, ErrNoCharactersRemaining) {
+		t.Fatalf(`Create for an unknown account returned %v, want ErrNoCharactersRemaining`, err)
+	}
+}
+
+func TestSQLStoreRemoveQuota(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, 0)
+	store := newSQLStore(db, dialectSQLite, "admin")
+
+	if err := store.RemoveQuota(ctx, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// tutorial-relational-db needs the row of the account.
+	var remaining sql.NullInt64
+	if err := db.QueryRow("SELECT characters_remaining FROM accounts WHERE name=?", "admin").Scan(&remaining); err != nil || remaining.Valid {
+		t.Fatalf(`characters_remaining after RemoveQuota = %v, %v, want NULL`, remaining, err)
+	}
+
+	if _, err := store.Create(ctx, Character{Name: "Themis", Level: 99}); err != nil {
+		t.Fatalf(`Create without a quota returned %v`, err)
+	}
+
+	if _, err := store.AdjustQuota(ctx, "admin", 1); !errors.Is(err, ErrQuotaNotFound) {
+		t.Fatalf(`AdjustQuota without a quota returned %v, want ErrQuotaNotFound`, err)
+	}
+}
+
+func TestSQLStoreDuplicateName(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, 10)
+	store := newSQLStore(db, dialectSQLite, "admin")
+
+	themis, err := store.Create(ctx, Character{Name: "Themis", Level: 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What a write gets when another transaction took the name after
+	// checkName.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO characters (name, name_key, role, level, version, owner) VALUES (?, ?, ?, ?, ?, ?)", "THEMIS", nameKey("THEMIS"), "", 1, 1, "admin")
+	var nameErr *NameTakenError
+	if err := store.nameTaken(ctx, tx, "THEMIS", err); !errors.As(err, &nameErr) || nameErr.ID != themis.ID {
+		t.Fatalf(`nameTaken of a duplicate key returned %v, want a *NameTakenError for %s`, err, themis.ID)
+	}
+}
+
+func TestSQLStoreConcurrentCreates(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "characters.db")
+	db := openSQLiteAt(t, path, 10)
+
+	// Each store has its own connections, like servers sharing the
+	// database would.
+	const workers = 8
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		store := newSQLStore(openSQLiteAt(t, path, -1), dialectSQLite, "admin")
+		go func() {
+			_, err := store.Create(ctx, Character{Name: "Themis", Level: 99})
+			errs <- err
+		}()
+	}
+
+	created := 0
+	for w := 0; w < workers; w++ {
+		var nameErr *NameTakenError
+		switch err := <-errs; {
+		case err == nil:
+			created++
+		case !errors.As(err, &nameErr):
+			t.Errorf(`Concurrent Create returned %v, want a *NameTakenError`, err)
+		}
+	}
+
+	if created != 1 || remaining(t, db) != 9 {
+		t.Fatalf(`%d concurrent Create succeeded with %d characters remaining, want 1 with 9`, created, remaining(t, db))
+	}
+}
+
+func TestSQLStoreInvalidID(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLStore(openSQLite(t, 1), dialectSQLite, "admin")
+
+	for _, id := range []string{"", "abc", seedCharacters[0].ID} {
+		if _, err := store.Get(ctx, id); !errors.Is(err, ErrCharacterNotFound) {
+			t.Errorf(`Get(%q) returned %v, want ErrCharacterNotFound`, id, err)
+		}
+	}
+}
+
+func TestQuotaEndpoint(t *testing.T) {
+	router := newRouter(newSQLStore(openSQLite(t, 0), dialectSQLite, "admin"))
+
+	if rec := do(router, "POST", "/characters", `{"name": "Themis", "role": "Elidibus", "level": 99}`); rec.Code != 403 {
+		t.Fatalf(`POST /characters over the quota = %d, want 403`, rec.Code)
+	}
+}
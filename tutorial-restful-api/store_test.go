@@ -0,0 +1,574 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// storeFactory returns an empty store for a test.
+type storeFactory func(t *testing.T) CharacterStore
+
+// storeFactories lists every CharacterStore implementation, so that
+// they're all held to the same behavior.
+var storeFactories = map[string]storeFactory{
+	"memory": func(t *testing.T) CharacterStore { return newMemoryStore() },
+	"file": func(t *testing.T) CharacterStore {
+		store, err := openFileStore(filepath.Join(t.TempDir(), "characters.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		return store
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, store CharacterStore)) {
+	for name, factory := range storeFactories {
+		factory := factory
+		t.Run(name, func(t *testing.T) {
+			test(t, factory(t))
+		})
+	}
+}
+
+func TestStoreCRUD(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		created, err := store.Create(ctx, Character{Name: "Thancred", Role: "Scion", Level: 80})
+		if err != nil || created.ID == "" {
+			t.Fatalf(`Create = %+v, %v, want a character with an ID`, created, err)
+		}
+
+		got, err := store.Get(ctx, created.ID)
+		if got != created || err != nil {
+			t.Fatalf(`Get(%q) = %+v, %v, want %+v, nil`, created.ID, got, err, created)
+		}
+
+		updated, err := store.Update(ctx, created.ID, replaceWith(Character{ID: "bogus", Name: "Thancred", Role: "Gunbreaker", Level: 90}))
+		if updated.ID != created.ID || updated.Role != "Gunbreaker" || err != nil {
+			t.Fatalf(`Update = %+v, %v, want the role changed and the ID kept`, updated, err)
+		}
+
+		if err := store.Delete(ctx, created.ID, nil); err != nil {
+			t.Fatalf(`Delete(%q) returned %v`, created.ID, err)
+		}
+
+		if _, err := store.Get(ctx, created.ID); !errors.Is(err, ErrCharacterNotFound) {
+			t.Fatalf(`Get after Delete returned %v, want ErrCharacterNotFound`, err)
+		}
+
+		if _, err := store.Update(ctx, created.ID, replaceWith(Character{Name: "Thancred"})); !errors.Is(err, ErrCharacterNotFound) {
+			t.Fatalf(`Update after Delete returned %v, want ErrCharacterNotFound`, err)
+		}
+
+		if err := store.Delete(ctx, created.ID, nil); !errors.Is(err, ErrCharacterNotFound) {
+			t.Fatalf(`Delete after Delete returned %v, want ErrCharacterNotFound`, err)
+		}
+	})
+}
+
+func TestStoreListOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		for _, name := range []string{"Thancred", "Y'shtola", "Urianger"} {
+			if _, err := store.Create(ctx, Character{Name: name, Role: "Scion", Level: 80}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		list, err := store.List(ctx)
+		if len(list) != 3 || err != nil {
+			t.Fatalf(`List returned %d characters, %v, want 3, nil`, len(list), err)
+		}
+
+		if list[0].Name != "Thancred" || list[2].Name != "Urianger" {
+			t.Fatalf(`List = %+v, want creation order`, list)
+		}
+	})
+}
+
+// TestStoreConcurrent hammers a store from many goroutines. It's
+// mostly useful with the race detector: go test -race.
+func TestStoreConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+		const workers = 8
+		const perWorker = 24
+
+		var wg sync.WaitGroup
+		wg.Add(workers)
+
+		for w := 0; w < workers; w++ {
+			go func(w int) {
+				defer wg.Done()
+
+				for i := 0; i < perWorker; i++ {
+					char, err := store.Create(ctx, Character{Name: fmt.Sprintf("Scion %d-%d", w, i), Role: "Scion", Level: 1})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+
+					char.Level = 2
+					if _, err := store.Update(ctx, char.ID, replaceWith(char)); err != nil {
+						t.Error(err)
+					}
+
+					if _, err := store.List(ctx); err != nil {
+						t.Error(err)
+					}
+
+					// Delete every other character.
+					if i%2 == 0 {
+						if err := store.Delete(ctx, char.ID, nil); err != nil {
+							t.Error(err)
+						}
+					}
+				}
+			}(w)
+		}
+
+		wg.Wait()
+
+		list, err := store.List(ctx)
+		if want := workers * perWorker / 2; len(list) != want || err != nil {
+			t.Fatalf(`List returned %d characters, %v, want %d, nil`, len(list), err, want)
+		}
+
+		for _, char := range list {
+			if char.Level != 2 {
+				t.Fatalf(`Character %+v wasn't updated`, char)
+			}
+		}
+	})
+}
+
+func TestStoreUpdateFunc(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+		char, _ := store.Create(ctx, Character{Name: "Lyse", Role: "Ala Mhigan Resistance", Level: 70})
+
+		errAbort := errors.New("abort")
+		_, err := store.Update(ctx, char.ID, func(current Character) (Character, error) {
+			if current != char {
+				t.Errorf(`Update passed %+v, want %+v`, current, char)
+			}
+
+			return Character{Name: "Lyse", Level: 1}, errAbort
+		})
+		if err != errAbort {
+			t.Fatalf(`Update returned %v, want the error of the update func`, err)
+		}
+
+		if got, _ := store.Get(ctx, char.ID); got != char {
+			t.Fatalf(`Get after an aborted Update = %+v, want %+v`, got, char)
+		}
+	})
+}
+
+// TestStoreUpdateAtomic increments a level from many goroutines, which
+// loses increments unless each update sees the previous one.
+func TestStoreUpdateAtomic(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+		char, _ := store.Create(ctx, Character{Name: "Alphinaud", Role: "Scion", Level: 1})
+
+		const increments = 40
+		var wg sync.WaitGroup
+		wg.Add(increments)
+
+		for i := 0; i < increments; i++ {
+			go func() {
+				defer wg.Done()
+
+				_, err := store.Update(ctx, char.ID, func(current Character) (Character, error) {
+					current.Level++
+					return current, nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if got, _ := store.Get(ctx, char.ID); got.Level != 1+increments {
+			t.Fatalf(`Level after %d concurrent increments = %d, want %d`, increments, got.Level, 1+increments)
+		}
+	})
+}
+
+func TestStoreVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		char, _ := store.Create(ctx, Character{Name: "Estinien", Role: "Dragoon", Level: 90, Version: 42})
+		if char.Version != 1 {
+			t.Fatalf(`Create returned version %d, want 1`, char.Version)
+		}
+
+		char, _ = store.Update(ctx, char.ID, replaceWith(Character{Name: "Estinien", Role: "Azure Dragoon", Level: 90, Version: 42}))
+		if got, _ := store.Get(ctx, char.ID); char.Version != 2 || got.Version != 2 {
+			t.Fatalf(`Update returned version %d and stored %d, want 2`, char.Version, got.Version)
+		}
+
+		errAbort := errors.New("abort")
+		if err := store.Delete(ctx, char.ID, func(current Character) error {
+			if current != char {
+				t.Errorf(`Delete checked %+v, want %+v`, current, char)
+			}
+
+			return errAbort
+		}); err != errAbort {
+			t.Fatalf(`Delete returned %v, want the error of the check`, err)
+		}
+
+		if _, err := store.Get(ctx, char.ID); err != nil {
+			t.Fatalf(`Get after an aborted Delete returned %v`, err)
+		}
+	})
+}
+
+func TestStoreRevisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := withAuthor(context.Background(), "alisaie")
+
+		char, _ := store.Create(ctx, Character{Name: "Alphinaud", Role: "Scion", Level: 80})
+		char.Role = "Sage"
+		char, _ = store.Update(withAuthor(ctx, "alphinaud"), char.ID, replaceWith(char))
+
+		revisions, err := store.Revisions(ctx, char.ID)
+		if err != nil || len(revisions) != 2 {
+			t.Fatalf(`Revisions(%q) = %+v, %v, want 2 revisions`, char.ID, revisions, err)
+		}
+
+		for idx, want := range []struct {
+			version int
+			role    string
+			author  string
+		}{{1, "Scion", "alisaie"}, {2, "Sage", "alphinaud"}} {
+			rev := revisions[idx]
+			if rev.Character.ID != char.ID || rev.Character.Version != want.version || rev.Character.Role != want.role || rev.Author != want.author || rev.Time.IsZero() {
+				t.Errorf(`Revisions(%q)[%d] = %+v, want version %d by %s`, char.ID, idx, rev, want.version, want.author)
+			}
+		}
+
+		store.Delete(ctx, char.ID, nil)
+		if _, err := store.Revisions(ctx, char.ID); !errors.Is(err, ErrCharacterNotFound) {
+			t.Fatalf(`Revisions(%q) after Delete returned %v, want ErrCharacterNotFound`, char.ID, err)
+		}
+	})
+}
+
+func TestStoreRevisionsLimit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		char, _ := store.Create(ctx, Character{Name: "Lyse", Level: 1})
+		for level := 2; level <= maxRevisions+10; level++ {
+			char.Level = level
+			char, _ = store.Update(ctx, char.ID, replaceWith(char))
+		}
+
+		revisions, _ := store.Revisions(ctx, char.ID)
+		if len(revisions) != maxRevisions || revisions[0].Character.Version != 11 || revisions[maxRevisions-1].Character != char {
+			t.Fatalf(`Revisions(%q) returned %d revisions from version %d, want the last %d`, char.ID, len(revisions), revisions[0].Character.Version, maxRevisions)
+		}
+	})
+}
+
+func TestStoreApply(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		thancred, _ := store.Create(ctx, Character{Name: "Thancred", Role: "Scion", Level: 80})
+		urianger, _ := store.Create(ctx, Character{Name: "Urianger", Role: "Scion", Level: 80})
+
+		results, err := store.Apply(ctx, []Operation{
+			{Op: opCreate, Character: Character{Name: "Ryne", Role: "Oracle of Light", Level: 80}},
+			{Op: opUpdate, ID: thancred.ID, Update: func(current Character) (Character, error) {
+				current.Role = "Gunbreaker"
+				return current, nil
+			}},
+			{Op: opDelete, ID: urianger.ID},
+		})
+		if err != nil || len(results) != 3 || results[0].ID == "" || results[1].Role != "Gunbreaker" || results[1].Version != 2 {
+			t.Fatalf(`Apply = %+v, %v, want Ryne created and Thancred updated`, results, err)
+		}
+
+		list, _ := store.List(ctx)
+		if got := names(list); got != "Thancred,Ryne" {
+			t.Fatalf(`List after Apply = %s, want Thancred,Ryne`, got)
+		}
+
+		// The failed deletion undoes the changes before it.
+		errAbort := errors.New("abort")
+		_, err = store.Apply(ctx, []Operation{
+			{Op: opCreate, Character: Character{Name: "Minfilia", Level: 70}},
+			{Op: opUpdate, ID: results[0].ID, Update: replaceWith(Character{Name: "Ryne", Role: "Gunbreaker", Level: 90})},
+			{Op: opDelete, ID: thancred.ID, Check: func(Character) error { return errAbort }},
+		})
+
+		var opErr *OperationError
+		if !errors.As(err, &opErr) || opErr.Index != 2 || !errors.Is(err, errAbort) {
+			t.Fatalf(`Apply with a failing operation returned %v, want an *OperationError for operation 2`, err)
+		}
+
+		list, _ = store.List(ctx)
+		if got := names(list); got != "Thancred,Ryne" || list[1] != results[0] {
+			t.Fatalf(`List after a failed Apply = %+v, want it unchanged`, list)
+		}
+
+		if revisions, _ := store.Revisions(ctx, results[0].ID); len(revisions) != 1 {
+			t.Fatalf(`Revisions after a failed Apply = %+v, want a single one`, revisions)
+		}
+
+		// Deleted characters come back where they were, with their
+		// history.
+		_, err = store.Apply(ctx, []Operation{
+			{Op: opDelete, ID: thancred.ID},
+			{Op: opUpdate, ID: urianger.ID, Update: replaceWith(Character{Name: "Urianger", Level: 90})},
+		})
+		list, _ = store.List(ctx)
+		if !errors.Is(err, ErrCharacterNotFound) || names(list) != "Thancred,Ryne" {
+			t.Fatalf(`Apply deleting Thancred, then failing = %v, %s, want Thancred back`, err, names(list))
+		}
+
+		if revisions, _ := store.Revisions(ctx, thancred.ID); len(revisions) != 2 {
+			t.Fatalf(`Revisions of Thancred after a failed Apply = %+v, want both`, revisions)
+		}
+	})
+}
+
+func TestStoreOwner(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		// The SQL store only lets accounts with a quota create characters.
+		store.SetQuota(ctx, "alisaie", 10)
+
+		char, _ := store.Create(ctx, Character{Name: "Alisaie", Level: 80, Owner: "alisaie"})
+		char, err := store.Update(ctx, char.ID, replaceWith(Character{Name: "Alisaie", Level: 90, Owner: "alphinaud"}))
+		if err != nil || char.Owner != "alisaie" {
+			t.Fatalf(`Update = %+v, %v, want the owner kept`, char, err)
+		}
+
+		if got, _ := store.Get(ctx, char.ID); got.Owner != "alisaie" {
+			t.Fatalf(`Get(%q) after Update = %+v, want the owner kept`, char.ID, got)
+		}
+
+		if revisions, _ := store.Revisions(ctx, char.ID); revisions[0].Character.Owner != "alisaie" {
+			t.Fatalf(`Revisions(%q) = %+v, want the owner in them`, char.ID, revisions)
+		}
+	})
+}
+
+func TestStoreQuotas(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		if _, err := store.SetQuota(ctx, "estinien", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		estinien, err := store.Create(ctx, Character{Name: "Estinien", Level: 90, Owner: "estinien"})
+		if err != nil {
+			t.Fatalf(`Create within the quota returned %v`, err)
+		}
+
+		if _, err := store.Create(ctx, Character{Name: "Nidhogg", Level: 99, Owner: "estinien"}); !errors.Is(err, ErrNoCharactersRemaining) {
+			t.Fatalf(`Create over the quota returned %v, want ErrNoCharactersRemaining`, err)
+		}
+
+		// A batch that fails gives back what it used up.
+		_, err = store.Apply(ctx, []Operation{
+			{Op: opDelete, ID: estinien.ID},
+			{Op: opCreate, Character: Character{Name: "Nidhogg", Level: 99, Owner: "estinien"}},
+			{Op: opCreate, Character: Character{Name: "Vidofnir", Level: 99, Owner: "estinien"}},
+		})
+		if !errors.Is(err, ErrNoCharactersRemaining) {
+			t.Fatalf(`Apply over the quota returned %v, want ErrNoCharactersRemaining`, err)
+		}
+
+		if quotas, _ := store.Quotas(ctx); !containsQuota(quotas, Quota{Account: "estinien", Remaining: 0}) {
+			t.Fatalf(`Quotas after a failed Apply = %+v, want estinien at 0`, quotas)
+		}
+
+		store.Delete(ctx, estinien.ID, nil)
+		if quota, err := store.AdjustQuota(ctx, "estinien", 2); quota != (Quota{Account: "estinien", Remaining: 3}) || err != nil {
+			t.Fatalf(`AdjustQuota after Delete = %+v, %v, want 3 remaining`, quota, err)
+		}
+
+		if _, err := store.AdjustQuota(ctx, "estinien", -4); !errors.Is(err, ErrQuotaTooLow) {
+			t.Fatalf(`AdjustQuota below zero returned %v, want ErrQuotaTooLow`, err)
+		}
+
+		if _, err := store.AdjustQuota(ctx, "nobody", 1); !errors.Is(err, ErrQuotaNotFound) {
+			t.Fatalf(`AdjustQuota without a quota returned %v, want ErrQuotaNotFound`, err)
+		}
+
+		if err := store.RemoveQuota(ctx, "estinien"); err != nil {
+			t.Fatal(err)
+		}
+
+		if quotas, _ := store.Quotas(ctx); containsQuota(quotas, Quota{Account: "estinien", Remaining: 3}) {
+			t.Fatalf(`Quotas after RemoveQuota = %+v, want estinien gone`, quotas)
+		}
+
+		if quota, err := store.Quota(ctx, "estinien"); !quota.Unlimited || quota.Default || err != nil {
+			t.Fatalf(`Quota after RemoveQuota = %+v, %v, want unlimited`, quota, err)
+		}
+
+		if quota, err := store.Quota(ctx, "nobody"); !quota.Default || err != nil {
+			t.Fatalf(`Quota without one = %+v, %v, want the default`, quota, err)
+		}
+
+		if err := store.RemoveQuota(ctx, "estinien"); !errors.Is(err, ErrQuotaNotFound) {
+			t.Fatalf(`RemoveQuota twice returned %v, want ErrQuotaNotFound`, err)
+		}
+
+		// Without a quota, there's no limit.
+		for i := 0; i < 5; i++ {
+			if _, err := store.Create(ctx, Character{Name: fmt.Sprintf("Estinien %d", i), Level: 90, Owner: "estinien"}); err != nil {
+				t.Fatalf(`Create #%d after RemoveQuota returned %v`, i+1, err)
+			}
+		}
+	})
+}
+
+func TestStoreUniqueNames(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+
+		zenos, err := store.Create(ctx, Character{Name: "Z\u00e9nos", Role: "Emperor", Level: 90})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The last one has an "e" followed by a combining accent.
+		for _, name := range []string{"Z\u00e9nos", "ZÉNOS", "ze\u0301nos"} {
+			var nameErr *NameTakenError
+			_, err := store.Create(ctx, Character{Name: name, Level: 1})
+			if !errors.As(err, &nameErr) || nameErr.ID != zenos.ID {
+				t.Fatalf(`Create(%q) returned %v, want a NameTakenError for %s`, name, err, zenos.ID)
+			}
+		}
+
+		other, err := store.Create(ctx, Character{Name: "Zenos yae Galvus", Level: 90})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Update(ctx, other.ID, replaceWith(Character{Name: "zÉnos", Level: 90})); !errors.Is(err, ErrNameTaken) {
+			t.Fatalf(`Update to a taken name returned %v, want ErrNameTaken`, err)
+		}
+
+		// Characters keep their own name, whatever its case.
+		if _, err := store.Update(ctx, zenos.ID, replaceWith(Character{Name: "ZÉNOS", Level: 90})); err != nil {
+			t.Fatalf(`Update of the case of a name returned %v`, err)
+		}
+
+		ops := []Operation{
+			{Op: opCreate, Character: Character{Name: "Fandaniel"}},
+			{Op: opCreate, Character: Character{Name: "FANDANIEL"}},
+		}
+		if _, err := store.Apply(ctx, ops); !errors.Is(err, ErrNameTaken) {
+			t.Fatalf(`Apply of the same name twice returned %v, want ErrNameTaken`, err)
+		}
+
+		// Names are free again once their character is deleted.
+		if err := store.Delete(ctx, zenos.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Create(ctx, Character{Name: "Zénos", Level: 90}); err != nil {
+			t.Fatalf(`Create of a deleted character's name returned %v`, err)
+		}
+	})
+}
+
+func TestStoreUniqueNamesConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store CharacterStore) {
+		ctx := context.Background()
+		const workers = 8
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		created := 0
+
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+
+				_, err := store.Create(ctx, Character{Name: "Themis", Role: "Elidibus", Level: 99})
+				if err != nil && !errors.Is(err, ErrNameTaken) {
+					t.Error(err)
+					return
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					created++
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if created != 1 {
+			t.Fatalf(`%d concurrent Create of the same name succeeded, want 1`, created)
+		}
+	})
+}
+
+func containsQuota(quotas []Quota, quota Quota) bool {
+	for _, q := range quotas {
+		if q == quota {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestMemoryStoreCounts(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore(seedCharacters...)
+
+	themis, _ := store.Create(ctx, Character{Name: "Themis", Level: 99})
+	for i := 0; i < maxRevisions+2; i++ {
+		store.Update(ctx, themis.ID, replaceWith(Character{Name: "Themis", Level: i}))
+	}
+
+	store.Delete(ctx, seedCharacters[0].ID, nil)
+	store.Apply(ctx, []Operation{
+		{Op: opCreate, Character: Character{Name: "Elidibus", Level: 90}},
+		{Op: opDelete, ID: themis.ID},
+		{Op: opUpdate, ID: seedCharacters[1].ID, Update: replaceWith(Character{Name: "Azem", Level: 99})},
+		{Op: opDelete, ID: "unknown"},
+	})
+
+	if want := len(store.revisions()); store.revisionCount != want {
+		t.Fatalf(`revisionCount = %d, want %d`, store.revisionCount, want)
+	}
+
+	names := make(map[string]int)
+	for _, char := range store.characters {
+		names[nameKey(char.Name)]++
+	}
+
+	if !reflect.DeepEqual(store.names, names) {
+		t.Fatalf(`names = %v, want %v`, store.names, names)
+	}
+}
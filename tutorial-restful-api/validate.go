@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// maxBodyBytes caps the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+// validate checks the `binding` tags of the payloads, reporting the
+// fields by their JSON names.
+var validate = newValidator()
+
+// fieldError describes what's wrong with a single field of a payload.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// errorDocument is the body of every error response. Errors is only
+// set when the problem can be pinned on specific fields.
+type errorDocument struct {
+	Message string       `json:"message"`
+	Errors  []fieldError `json:"errors,omitempty"`
+	// Location is the path of the resource that's in the way, if
+	// there's one, e.g. the character that already has a name.
+	Location string `json:"location,omitempty"`
+}
+
+// clientError is an error that's the client's fault, along with the
+// response it deserves. It lets handlers reject a request from code
+// running inside the store, e.g. an UpdateFunc.
+type clientError struct {
+	status int
+	doc    errorDocument
+}
+
+func (e *clientError) Error() string {
+	return e.doc.Message
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	return v
+}
+
+// bindCharacter decodes the JSON body into char and validates it.
+// Bodies that aren't a single JSON object with known fields get a 400
+// Bad Request, and characters that break the rules in the `binding`
+// tags get a 422 Unprocessable Entity. In both cases, it responds
+// itself and returns false.
+func bindCharacter(c *gin.Context, char *Character) bool {
+	if !decodeBody(c, char) {
+		return false
+	}
+
+	if err := checkCharacter(*char); err != nil {
+		respondWithError(c, err)
+		return false
+	}
+
+	return true
+}
+
+// decodeBody decodes the JSON body into v. Bodies that aren't a single
+// JSON object with known fields get a 400 Bad Request, to which it
+// responds itself and returns false.
+func decodeBody(c *gin.Context, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, decodeError(err))
+		return false
+	}
+
+	if decoder.More() {
+		c.IndentedJSON(http.StatusBadRequest, errorDocument{Message: "The request body must hold a single JSON object"})
+		return false
+	}
+
+	return true
+}
+
+// checkCharacter validates char against its `binding` tags. If it's
+// invalid, the error is a *clientError for a 422 Unprocessable Entity.
+func checkCharacter(char Character) error {
+	err := validate.Struct(char)
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	doc := errorDocument{Message: "Invalid character"}
+	for _, fe := range validationErrs {
+		doc.Errors = append(doc.Errors, fieldError{Field: fe.Field(), Message: ruleMessage(fe)})
+	}
+
+	return &clientError{status: http.StatusUnprocessableEntity, doc: doc}
+}
+
+// decodeError describes why the body couldn't be decoded.
+func decodeError(err error) errorDocument {
+	doc := errorDocument{Message: "Malformed request body"}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == io.EOF:
+		doc.Message = "The request body is empty"
+	case errors.As(err, &typeErr):
+		doc.Errors = []fieldError{{Field: typeErr.Field, Message: "must be a JSON " + jsonType(typeErr.Type.Kind())}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no dedicated type for this one.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		doc.Errors = []fieldError{{Field: field, Message: "is not a known field"}}
+	case err.Error() == "http: request body too large":
+		doc.Message = fmt.Sprintf("The request body must be at most %d bytes", maxBodyBytes)
+	}
+
+	return doc
+}
+
+// ruleMessage explains the rule that a field broke.
+func ruleMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters long"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	default:
+		return fmt.Sprintf("breaks the %q rule", fe.Tag())
+	}
+}
+
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return kind.String()
+	}
+}
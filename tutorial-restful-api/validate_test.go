@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCharacterValidation(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+		errors []fieldError
+	}{
+		{`{"name": "Themis", "role": "Elidibus", "level": 99}`, http.StatusCreated, nil},
+		{``, http.StatusBadRequest, nil},
+		{`{"name": "Themis"`, http.StatusBadRequest, nil},
+		{`{"name": "Themis", "level": 1} {}`, http.StatusBadRequest, nil},
+		{`{"name": "Themis", "level": 1, "job": "Paladin"}`, http.StatusBadRequest, []fieldError{{"job", "is not a known field"}}},
+		{`{"name": "Themis", "level": "99"}`, http.StatusBadRequest, []fieldError{{"level", "must be a JSON number"}}},
+		{`{"role": "Elidibus", "level": 99}`, http.StatusUnprocessableEntity, []fieldError{{"name", "is required"}}},
+		{`{"name": "Themis", "level": 0}`, http.StatusUnprocessableEntity, []fieldError{{"level", "must be at least 1"}}},
+		{`{"name": "Themis", "level": 100}`, http.StatusUnprocessableEntity, []fieldError{{"level", "must be at most 99"}}},
+		{
+			`{"name": "` + strings.Repeat("a", 129) + `", "role": "` + strings.Repeat("b", 256) + `", "level": 1}`,
+			http.StatusUnprocessableEntity,
+			[]fieldError{{"name", "must be at most 128 characters long"}, {"role", "must be at most 255 characters long"}},
+		},
+	}
+
+	for _, test := range tests {
+		router := newRouter(newMemoryStore())
+
+		rec := do(router, "POST", "/characters", test.body)
+		if rec.Code != test.status {
+			t.Errorf(`POST /characters %s = %d, want %d`, test.body, rec.Code, test.status)
+			continue
+		}
+
+		if test.status < 400 {
+			continue
+		}
+
+		var doc errorDocument
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc.Message == "" {
+			t.Errorf(`POST /characters %s returned %s, want an error document`, test.body, rec.Body)
+			continue
+		}
+
+		if !reflect.DeepEqual(doc.Errors, test.errors) {
+			t.Errorf(`POST /characters %s returned errors %+v, want %+v`, test.body, doc.Errors, test.errors)
+		}
+	}
+}
+
+// TestInvalidUpdateKeepsCharacter makes sure that a malformed PUT
+// doesn't wipe the character.
+func TestInvalidUpdateKeepsCharacter(t *testing.T) {
+	router := newRouter(newMemoryStore(seedCharacters...))
+	hades := seedCharacters[0]
+
+	for _, body := range []string{`not json`, `{}`, `{"name": "Hades", "level": 0}`} {
+		if rec := do(router, "PUT", "/characters/"+hades.ID, body); rec.Code < 400 {
+			t.Fatalf(`PUT /characters/%s %s = %d, want an error`, hades.ID, body, rec.Code)
+		}
+	}
+
+	var got Character
+	rec := do(router, "GET", "/characters/"+hades.ID, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got != hades {
+		t.Fatalf(`GET /characters/%s = %s, want %+v`, hades.ID, rec.Body, hades)
+	}
+}